@@ -0,0 +1,252 @@
+/*
+	Copyright © 2023, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+	SPDX-License-Identifier: Apache-2.0
+*/
+
+// Package aggregation downsamples the events of an ESP subscription into tumbling time buckets.
+package aggregation
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"grafana-esp-plugin/internal/esp/field"
+	"grafana-esp-plugin/internal/esp/windowevent"
+	"grafana-esp-plugin/internal/esp/windowstate"
+)
+
+// Function is an aggregate function applied to the values of numeric fields within a bucket.
+type Function string
+
+const (
+	Min   Function = "min"
+	Max   Function = "max"
+	Avg   Function = "avg"
+	Last  Function = "last"
+	Count Function = "count"
+)
+
+func ParseFunction(name string) (Function, error) {
+	function := Function(strings.ToLower(name))
+	switch function {
+	case Min, Max, Avg, Last, Count:
+		return function, nil
+	default:
+		return "", fmt.Errorf("unsupported aggregate function: %s", name)
+	}
+}
+
+// FieldName returns the name of the field holding the aggregate of the field of the given name.
+func (function Function) FieldName(fieldName string) string {
+	return fmt.Sprintf("%s(%s)", function, fieldName)
+}
+
+// Aggregator aggregates the numeric fields of window events into buckets of a fixed interval, aligned to the event
+// times. Events are grouped within a bucket by the values of the group fields, which are kept in the aggregated
+// events. Delete events are left out. A bucket is complete once an event of a later bucket is added, or once no
+// events have been added for a whole tick.
+type Aggregator struct {
+	interval    time.Duration
+	functions   []Function
+	groupFields []string
+	buckets     []*bucket
+	bucketIndex map[string]*bucket
+	latest      time.Time
+	idle        bool
+}
+
+type bucket struct {
+	start       time.Time
+	groupFields []field.Field
+	aggregates  []*aggregate
+	index       map[string]*aggregate
+}
+
+type aggregate struct {
+	name  string
+	count int64
+	sum   float64
+	min   float64
+	max   float64
+	last  float64
+}
+
+func New(interval time.Duration, functions []Function, groupFields []string) *Aggregator {
+	return &Aggregator{
+		interval:    interval,
+		functions:   functions,
+		groupFields: groupFields,
+		bucketIndex: make(map[string]*bucket),
+	}
+}
+
+// Add adds window events to the buckets of their times.
+func (a *Aggregator) Add(windowEvents []windowevent.WindowEvent) {
+	a.idle = false
+
+	for _, windowEvent := range windowEvents {
+		if windowEvent.Opcode == windowstate.OpcodeDelete || windowEvent.Opcode == windowstate.OpcodeSafeDelete {
+			continue
+		}
+
+		b := a.bucketOf(windowEvent)
+		for _, f := range windowEvent.Fields {
+			value, ok := numericValue(f.Value)
+			if !ok || b.isGroupField(f.Name) {
+				continue
+			}
+
+			agg, ok := b.index[f.Name]
+			if !ok {
+				agg = &aggregate{name: f.Name, min: math.Inf(1), max: math.Inf(-1)}
+				b.index[f.Name] = agg
+				b.aggregates = append(b.aggregates, agg)
+			}
+			agg.add(value)
+		}
+	}
+}
+
+// Completed removes the complete buckets and returns their aggregated events.
+func (a *Aggregator) Completed() []windowevent.WindowEvent {
+	return a.take(func(b *bucket) bool {
+		return b.start.Before(a.latest)
+	})
+}
+
+// Tick is called once per interval. It removes all buckets and returns their aggregated events if no events have
+// been added since the previous tick, as the buckets would otherwise not be completed until events arrive again.
+func (a *Aggregator) Tick() []windowevent.WindowEvent {
+	if !a.idle {
+		a.idle = true
+		return nil
+	}
+
+	return a.take(func(*bucket) bool {
+		return true
+	})
+}
+
+func (a *Aggregator) bucketOf(windowEvent windowevent.WindowEvent) *bucket {
+	start := windowEvent.Time.Truncate(a.interval)
+	if start.After(a.latest) {
+		a.latest = start
+	}
+
+	groupFields := make([]field.Field, 0, len(a.groupFields))
+	for _, groupField := range a.groupFields {
+		for _, f := range windowEvent.Fields {
+			if f.Name == groupField {
+				groupFields = append(groupFields, f)
+				break
+			}
+		}
+	}
+
+	key := bucketKey(start, groupFields)
+	b, ok := a.bucketIndex[key]
+	if !ok {
+		b = &bucket{start: start, groupFields: groupFields, index: make(map[string]*aggregate)}
+		a.bucketIndex[key] = b
+		a.buckets = append(a.buckets, b)
+	}
+
+	return b
+}
+
+// take removes the buckets matching the predicate and returns their aggregated events, in the order in which the
+// buckets were created.
+func (a *Aggregator) take(isTaken func(*bucket) bool) []windowevent.WindowEvent {
+	var windowEvents []windowevent.WindowEvent
+	kept := a.buckets[:0]
+	for _, b := range a.buckets {
+		if !isTaken(b) {
+			kept = append(kept, b)
+			continue
+		}
+
+		windowEvents = append(windowEvents, b.toWindowEvent(a.functions))
+		delete(a.bucketIndex, bucketKey(b.start, b.groupFields))
+	}
+	for i := len(kept); i < len(a.buckets); i++ {
+		a.buckets[i] = nil
+	}
+	a.buckets = kept
+
+	return windowEvents
+}
+
+// bucketKey returns the key identifying the bucket of the given start and group field values.
+func bucketKey(start time.Time, groupFields []field.Field) string {
+	key := strings.Builder{}
+	key.WriteString(strconv.FormatInt(start.UnixNano(), 10))
+	for _, f := range groupFields {
+		key.WriteString(fmt.Sprintf("\x00%v", f.Value))
+	}
+
+	return key.String()
+}
+
+func (b *bucket) isGroupField(name string) bool {
+	for _, f := range b.groupFields {
+		if f.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// toWindowEvent returns an event timed at the start of the bucket, holding the group fields followed by the
+// aggregates of every numeric field.
+func (b *bucket) toWindowEvent(functions []Function) windowevent.WindowEvent {
+	fields := make([]field.Field, 0, len(b.groupFields)+len(b.aggregates)*len(functions))
+	fields = append(fields, b.groupFields...)
+	for _, agg := range b.aggregates {
+		for _, function := range functions {
+			fields = append(fields, field.New(function.FieldName(agg.name), agg.value(function)))
+		}
+	}
+
+	return windowevent.New(b.start, windowstate.OpcodeInsert, fields)
+}
+
+func (agg *aggregate) add(value float64) {
+	agg.count++
+	agg.sum += value
+	agg.min = math.Min(agg.min, value)
+	agg.max = math.Max(agg.max, value)
+	agg.last = value
+}
+
+func (agg *aggregate) value(function Function) any {
+	switch function {
+	case Min:
+		return agg.min
+	case Max:
+		return agg.max
+	case Avg:
+		return agg.sum / float64(agg.count)
+	case Last:
+		return agg.last
+	default:
+		return agg.count
+	}
+}
+
+// numericValue returns the value of a numeric field as float64, and whether the value is numeric and not null.
+func numericValue(value any) (float64, bool) {
+	switch v := value.(type) {
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,140 @@
+/*
+	Copyright © 2023, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+	SPDX-License-Identifier: Apache-2.0
+*/
+
+package aggregation
+
+import (
+	"testing"
+	"time"
+
+	"grafana-esp-plugin/internal/esp/field"
+	"grafana-esp-plugin/internal/esp/windowevent"
+)
+
+func newSensorEvent(millis int64, opcode string, sensor string, value float64) windowevent.WindowEvent {
+	return windowevent.New(time.UnixMilli(millis), opcode, []field.Field{
+		field.New("sensor", sensor),
+		field.New("value", value),
+		field.New("count", int32(1)),
+		field.New("missing", (*float64)(nil)),
+	})
+}
+
+func fieldValue(windowEvent windowevent.WindowEvent, name string) any {
+	for _, f := range windowEvent.Fields {
+		if f.Name == name {
+			return f.Value
+		}
+	}
+
+	return nil
+}
+
+func TestAggregatorBuckets(t *testing.T) {
+	a := New(time.Second, []Function{Min, Max, Avg, Last, Count}, nil)
+
+	a.Add([]windowevent.WindowEvent{
+		newSensorEvent(100, "insert", "a", 1),
+		newSensorEvent(200, "insert", "b", 3),
+		newSensorEvent(300, "delete", "b", 100),
+		newSensorEvent(900, "upsert", "a", 2),
+	})
+	if completed := a.Completed(); len(completed) != 0 {
+		t.Fatalf("expected no events, got %v", completed)
+	}
+
+	a.Add([]windowevent.WindowEvent{newSensorEvent(1100, "insert", "a", 5)})
+	completed := a.Completed()
+	if len(completed) != 1 {
+		t.Fatalf("expected %v events, got %v", 1, completed)
+	}
+
+	aggregated := completed[0]
+	if !aggregated.Time.Equal(time.UnixMilli(0)) {
+		t.Errorf("expected %v, got %v", time.UnixMilli(0), aggregated.Time)
+	}
+	expected := map[string]any{
+		"min(value)":   1.0,
+		"max(value)":   3.0,
+		"avg(value)":   2.0,
+		"last(value)":  2.0,
+		"count(value)": int64(3),
+		"sum(count)":   nil,
+		"avg(count)":   1.0,
+		"avg(missing)": nil,
+		"avg(sensor)":  nil,
+	}
+	for name, expectedValue := range expected {
+		if value := fieldValue(aggregated, name); value != expectedValue {
+			t.Errorf("%s: expected %v, got %v", name, expectedValue, value)
+		}
+	}
+	if len(aggregated.Fields) != 10 {
+		t.Errorf("expected %v fields, got %v", 10, aggregated.Fields)
+	}
+}
+
+func TestAggregatorGroupFields(t *testing.T) {
+	a := New(time.Second, []Function{Avg}, []string{"sensor"})
+
+	a.Add([]windowevent.WindowEvent{
+		newSensorEvent(100, "insert", "a", 1),
+		newSensorEvent(200, "insert", "b", 3),
+		newSensorEvent(300, "insert", "a", 2),
+		newSensorEvent(1100, "insert", "b", 5),
+	})
+
+	completed := a.Completed()
+	if len(completed) != 2 {
+		t.Fatalf("expected %v events, got %v", 2, completed)
+	}
+
+	for i, expected := range []struct {
+		sensor string
+		avg    float64
+	}{{"a", 1.5}, {"b", 3}} {
+		if sensor := fieldValue(completed[i], "sensor"); sensor != expected.sensor {
+			t.Errorf("expected %v, got %v", expected.sensor, sensor)
+		}
+		if avg := fieldValue(completed[i], "avg(value)"); avg != expected.avg {
+			t.Errorf("expected %v, got %v", expected.avg, avg)
+		}
+		if sensor := fieldValue(completed[i], "avg(sensor)"); sensor != nil {
+			t.Errorf("expected nil, got %v", sensor)
+		}
+	}
+}
+
+func TestAggregatorTick(t *testing.T) {
+	a := New(time.Second, []Function{Count}, nil)
+
+	a.Add([]windowevent.WindowEvent{newSensorEvent(100, "insert", "a", 1)})
+	if ticked := a.Tick(); len(ticked) != 0 {
+		t.Fatalf("expected no events, got %v", ticked)
+	}
+
+	ticked := a.Tick()
+	if len(ticked) != 1 {
+		t.Fatalf("expected %v events, got %v", 1, ticked)
+	}
+	if count := fieldValue(ticked[0], "count(value)"); count != int64(1) {
+		t.Errorf("expected %v, got %v", int64(1), count)
+	}
+
+	if ticked := a.Tick(); len(ticked) != 0 {
+		t.Errorf("expected no events, got %v", ticked)
+	}
+}
+
+func TestParseFunction(t *testing.T) {
+	function, err := ParseFunction("AVG")
+	if err != nil || function != Avg {
+		t.Errorf("expected %v, got %v (%v)", Avg, function, err)
+	}
+
+	if _, err := ParseFunction("median"); err == nil {
+		t.Errorf("expected non-nil error")
+	}
+}
@@ -0,0 +1,47 @@
+/*
+	Copyright © 2023, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+	SPDX-License-Identifier: Apache-2.0
+*/
+
+package client
+
+import (
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+type Backoff struct {
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+	Multiplier   float64
+	// Jitter is the fraction (0-1) of the computed delay that is randomized.
+	Jitter float64
+}
+
+var DefaultBackoff = Backoff{
+	InitialDelay: 500 * time.Millisecond,
+	MaxDelay:     30 * time.Second,
+	Multiplier:   2,
+	Jitter:       0.2,
+}
+
+// Delay returns the time to wait before the given (1-based) reconnection attempt.
+func (b Backoff) Delay(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+
+	delay := float64(b.InitialDelay) * math.Pow(b.Multiplier, float64(attempt-1))
+	if delay > float64(b.MaxDelay) {
+		delay = float64(b.MaxDelay)
+	}
+
+	jitter := delay * b.Jitter
+	delay = delay - jitter + rand.Float64()*2*jitter
+	if delay > float64(b.MaxDelay) {
+		delay = float64(b.MaxDelay)
+	}
+
+	return time.Duration(delay)
+}
@@ -0,0 +1,49 @@
+/*
+	Copyright © 2023, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+	SPDX-License-Identifier: Apache-2.0
+*/
+
+package client
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoffDelayGrowsExponentially(t *testing.T) {
+	b := Backoff{InitialDelay: time.Second, MaxDelay: time.Minute, Multiplier: 2, Jitter: 0}
+
+	equalityAssertions := []struct {
+		Attempt  int
+		Expected time.Duration
+	}{
+		{0, time.Second},
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{10, time.Minute},
+	}
+
+	for _, equalityAssertion := range equalityAssertions {
+		actual := b.Delay(equalityAssertion.Attempt)
+		if actual != equalityAssertion.Expected {
+			t.Errorf("attempt %d: expected %v, got %v", equalityAssertion.Attempt, equalityAssertion.Expected, actual)
+		}
+	}
+}
+
+func TestBackoffDelayJitterIsBounded(t *testing.T) {
+	b := Backoff{InitialDelay: time.Second, MaxDelay: 10 * time.Second, Multiplier: 2, Jitter: 0.5}
+
+	for i := 0; i < 1000; i++ {
+		delay := b.Delay(3)
+		if delay < 2*time.Second || delay > 6*time.Second {
+			t.Fatalf("expected delay within [2s, 6s], got %v", delay)
+		}
+
+		delay = b.Delay(100)
+		if delay < 5*time.Second || delay > 10*time.Second {
+			t.Fatalf("expected delay within [5s, 10s], got %v", delay)
+		}
+	}
+}
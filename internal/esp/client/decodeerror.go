@@ -0,0 +1,136 @@
+/*
+	Copyright © 2023, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+	SPDX-License-Identifier: Apache-2.0
+*/
+
+package client
+
+import (
+	"fmt"
+	"time"
+
+	"grafana-esp-plugin/internal/esp/field"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+type DecodeErrorKind int
+
+const (
+	// DecodeErrorMalformedEvent is reported for events whose timestamp, opcode or structure cannot be decoded.
+	DecodeErrorMalformedEvent DecodeErrorKind = iota
+	// DecodeErrorMissingSchema is reported for fields that are not part of the schema received for the subscription.
+	DecodeErrorMissingSchema
+	// DecodeErrorUnknownType is reported for fields whose schema type is not supported.
+	DecodeErrorUnknownType
+	// DecodeErrorTypeMismatch is reported for field values that do not match the schema type of the field.
+	DecodeErrorTypeMismatch
+	decodeErrorKindCount
+)
+
+func (kind DecodeErrorKind) String() string {
+	switch kind {
+	case DecodeErrorMalformedEvent:
+		return "malformed_event"
+	case DecodeErrorMissingSchema:
+		return "missing_schema"
+	case DecodeErrorUnknownType:
+		return "unknown_type"
+	case DecodeErrorTypeMismatch:
+		return "type_mismatch"
+	default:
+		return "unknown"
+	}
+}
+
+// DecodeError is returned when an event received from the server cannot be decoded. FieldName is empty for errors
+// concerning the event as a whole.
+type DecodeError struct {
+	Kind      DecodeErrorKind
+	FieldName string
+	Message   string
+}
+
+func (e *DecodeError) Error() string {
+	if e.FieldName == "" {
+		return fmt.Sprintf("%s: %s", e.Kind, e.Message)
+	}
+
+	return fmt.Sprintf("%s: field %s: %s", e.Kind, e.FieldName, e.Message)
+}
+
+func newDecodeError(kind DecodeErrorKind, fieldName string, format string, args ...any) *DecodeError {
+	return &DecodeError{Kind: kind, FieldName: fieldName, Message: fmt.Sprintf(format, args...)}
+}
+
+// DecodeErrorPolicy determines how events with fields that cannot be decoded are handled. Events that are
+// malformed as a whole are always skipped.
+type DecodeErrorPolicy int
+
+const (
+	// DecodeErrorPolicyNullField keeps the event and sets the field to null. Fields without a known schema type are
+	// left out of the event.
+	DecodeErrorPolicyNullField DecodeErrorPolicy = iota
+	// DecodeErrorPolicySkipField keeps the event and leaves the field out.
+	DecodeErrorPolicySkipField
+	// DecodeErrorPolicySkipEvent drops the whole event.
+	DecodeErrorPolicySkipEvent
+)
+
+// ParseDecodeErrorPolicy parses a decode error policy name. The empty string selects the default,
+// DecodeErrorPolicyNullField.
+func ParseDecodeErrorPolicy(policy string) (DecodeErrorPolicy, error) {
+	switch policy {
+	case "", "null-field":
+		return DecodeErrorPolicyNullField, nil
+	case "skip-field":
+		return DecodeErrorPolicySkipField, nil
+	case "skip-event":
+		return DecodeErrorPolicySkipEvent, nil
+	default:
+		return DecodeErrorPolicyNullField, fmt.Errorf("unsupported decode error policy: %s", policy)
+	}
+}
+
+var decodeErrorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "grafana_esp_plugin",
+	Name:      "decode_errors_total",
+	Help:      "Number of ESP event fields and events that could not be decoded, by kind of error.",
+}, []string{"kind"})
+
+// DecodeErrorCount returns the number of decode errors of the given kind encountered by the client.
+func (espWsClient *EspWsClient) DecodeErrorCount(kind DecodeErrorKind) uint64 {
+	if kind < 0 || kind >= decodeErrorKindCount {
+		return 0
+	}
+
+	return espWsClient.decodeErrorCounts[kind].Load()
+}
+
+func (espWsClient *EspWsClient) countDecodeError(err *DecodeError) {
+	espWsClient.decodeErrorCounts[err.Kind].Add(1)
+	decodeErrorsTotal.WithLabelValues(err.Kind.String()).Inc()
+}
+
+// nullFieldValue returns a null value typed after the schema type, so that frames can hold it in a nullable field.
+func nullFieldValue(schemaType field.SchemaType) any {
+	switch schemaType {
+	case field.Int32:
+		return (*int32)(nil)
+	case field.Int64:
+		return (*int64)(nil)
+	case field.Double, field.Money:
+		return (*float64)(nil)
+	case field.ArrayDouble:
+		return []*float64(nil)
+	case field.ArrayInt32:
+		return []*int32(nil)
+	case field.ArrayInt64:
+		return []*int64(nil)
+	case field.Timestamp, field.Date:
+		return (*time.Time)(nil)
+	default:
+		return (*string)(nil)
+	}
+}
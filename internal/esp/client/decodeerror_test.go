@@ -0,0 +1,193 @@
+/*
+	Copyright © 2023, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+	SPDX-License-Identifier: Apache-2.0
+*/
+
+package client
+
+import (
+	"testing"
+
+	"grafana-esp-plugin/internal/esp/fakeserver"
+	"grafana-esp-plugin/internal/esp/field"
+)
+
+func TestParseDecodeErrorPolicy(t *testing.T) {
+	equalityAssertions := map[string]DecodeErrorPolicy{
+		"":           DecodeErrorPolicyNullField,
+		"null-field": DecodeErrorPolicyNullField,
+		"skip-field": DecodeErrorPolicySkipField,
+		"skip-event": DecodeErrorPolicySkipEvent,
+	}
+
+	for policyName, expected := range equalityAssertions {
+		actual, err := ParseDecodeErrorPolicy(policyName)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if expected != actual {
+			t.Errorf("expected %v, got %v", expected, actual)
+		}
+	}
+
+	_, err := ParseDecodeErrorPolicy("panic")
+	if err == nil {
+		t.Errorf("expected non-nil error")
+	}
+}
+
+// sendBadEvents sends an event with a value of the wrong type, followed by a valid event.
+func sendBadEvents(t *testing.T, s *fakeserver.Server, sub *Subscription) {
+	sendTestEvents(t, s, sub.Id())
+
+	badEntry := testEntry(1)
+	badEntry["value"] = "not a double"
+
+	err := s.SendEvents(sub.Id(), []map[string]any{badEntry, testEntry(2)})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestDecodeErrorPolicies(t *testing.T) {
+	testCases := []struct {
+		policy         DecodeErrorPolicy
+		expectedFields []field.Field
+	}{
+		{DecodeErrorPolicyNullField, []field.Field{field.New("id", int64(1)), field.New("value", (*float64)(nil))}},
+		{DecodeErrorPolicySkipField, []field.Field{field.New("id", int64(1))}},
+		{DecodeErrorPolicySkipEvent, []field.Field{field.New("id", int64(2)), field.New("value", float64(1))}},
+	}
+
+	for _, testCase := range testCases {
+		s, c := newTestClient(t)
+		c.DecodeErrorPolicy = testCase.policy
+		drainEvents(c)
+
+		sub, err := c.Subscribe("project", "cq", "window", 0, 0, nil, CborFormat, false)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		sendBadEvents(t, s, sub)
+
+		event := waitForWindowEvent(t, sub)
+		if len(event.Fields) != len(testCase.expectedFields) {
+			t.Fatalf("policy %v: expected %v, got %v", testCase.policy, testCase.expectedFields, event.Fields)
+		}
+		for i, expected := range testCase.expectedFields {
+			if expected.Name != event.Fields[i].Name || expected.Value != event.Fields[i].Value {
+				t.Errorf("policy %v: expected %v, got %v", testCase.policy, expected, event.Fields[i])
+			}
+		}
+
+		count := c.DecodeErrorCount(DecodeErrorTypeMismatch)
+		if count != 1 {
+			t.Errorf("policy %v: expected %v, got %v", testCase.policy, 1, count)
+		}
+	}
+}
+
+func TestMalformedEventsAreSkipped(t *testing.T) {
+	s, c := newTestClient(t)
+	drainEvents(c)
+
+	sub, err := c.Subscribe("project", "cq", "window", 0, 0, nil, JsonFormat, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	sendTestEvents(t, s, sub.Id())
+
+	missingTimestamp := testEntry(1)
+	delete(missingTimestamp, "@timestamp")
+	missingOpcode := testEntry(2)
+	delete(missingOpcode, "@opcode")
+
+	err = s.SendEvents(sub.Id(), []map[string]any{missingTimestamp, missingOpcode, testEntry(3)})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	event := waitForWindowEvent(t, sub)
+	if event.Fields[0].Value != int64(3) {
+		t.Errorf("expected %v, got %v", int64(3), event.Fields[0].Value)
+	}
+
+	count := c.DecodeErrorCount(DecodeErrorMalformedEvent)
+	if count != 2 {
+		t.Errorf("expected %v, got %v", 2, count)
+	}
+}
+
+func TestJsonBlobTypeMismatchDoesNotPanic(t *testing.T) {
+	s, c := newTestClient(t)
+	drainEvents(c)
+
+	sub, err := c.Subscribe("project", "cq", "window", 0, 0, nil, JsonFormat, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	err = s.WaitForSubscription(testContext(t), sub.Id())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	err = s.SendSchema(sub.Id(), []fakeserver.SchemaField{
+		{Name: "id", Type: "int64", Key: true},
+		{Name: "image", Type: "blob"},
+		{Name: "name", Type: "string"},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// The fake server converts blobs to their JSON representation, so the blob and string fields are swapped to
+	// produce values that do not match the schema.
+	entry := testEntry(1)
+	delete(entry, "value")
+	entry["image"] = "not a blob"
+	entry["name"] = []byte{0x00}
+
+	err = s.SendEvents(sub.Id(), []map[string]any{entry})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	event := waitForWindowEvent(t, sub)
+	if len(event.Fields) != 3 || event.Fields[1].Value != (*string)(nil) || event.Fields[2].Value != (*string)(nil) {
+		t.Errorf("expected null blob and string fields, got %v", event.Fields)
+	}
+
+	count := c.DecodeErrorCount(DecodeErrorTypeMismatch)
+	if count != 2 {
+		t.Errorf("expected %v, got %v", 2, count)
+	}
+}
+
+func TestMissingSchemaFieldIsReported(t *testing.T) {
+	s, c := newTestClient(t)
+	drainEvents(c)
+
+	sub, err := c.Subscribe("project", "cq", "window", 0, 0, nil, CborFormat, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	sendTestEvents(t, s, sub.Id())
+
+	entry := testEntry(1)
+	entry["unknown"] = "value"
+
+	err = s.SendEvents(sub.Id(), []map[string]any{entry})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	event := waitForWindowEvent(t, sub)
+	if len(event.Fields) != 2 {
+		t.Errorf("expected %v, got %v", 2, event.Fields)
+	}
+
+	count := c.DecodeErrorCount(DecodeErrorMissingSchema)
+	if count != 1 {
+		t.Errorf("expected %v, got %v", 1, count)
+	}
+}
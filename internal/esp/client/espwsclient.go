@@ -6,43 +6,102 @@
 package client
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"math"
+	"net/http"
 	"net/url"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"encoding/base64"
 	"encoding/json"
 
 	"grafana-esp-plugin/internal/esp/client/messagedto"
+	"grafana-esp-plugin/internal/esp/client/transport"
 	"grafana-esp-plugin/internal/esp/field"
 	"grafana-esp-plugin/internal/esp/windowevent"
 
 	"github.com/google/uuid"
 	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
-	"github.com/sacOO7/gowebsocket"
 
 	"github.com/fxamacker/cbor"
 )
 
+// EspWsClient is a websocket client of an ESP server. All connection and subscription state is owned by a single
+// event loop goroutine, which is started by Connect and stopped by Close or by cancelling the context passed to
+// Connect. Connection-wide events are emitted on Events, which must be drained by the caller; it is closed once the
+// event loop has stopped.
 type EspWsClient struct {
-	socket                 *gowebsocket.Socket
-	isConnected            bool
-	subscriptions          map[string]*subscription
-	Errors                 chan error
-	OnConnected            func()
-	OnEventMessageReceived func(windowevent.WindowEvent)
-	OnProjectLoaded        func(string)
-	OnProjectRemoved       func(string)
+	url               url.URL
+	requestHeader     http.Header
+	started           atomic.Bool
+	ctx               context.Context
+	cancel            context.CancelFunc
+	done              chan struct{}
+	commands          chan func()
+	incoming          chan connMessage
+	events            chan Event
+	conn              transport.Connection
+	connGeneration    int
+	isConnected       bool
+	subscriptions     map[string]*subscription
+	reconnectAttempt  int
+	reconnectTimer    *time.Timer
+	decodeErrorCounts [decodeErrorKindCount]atomic.Uint64
+	Backoff           Backoff
+	Transport         transport.Transport
+	DecodeErrorPolicy DecodeErrorPolicy
 }
 
+// subscription holds the state of a subscription on the event loop. The schema is the schema of the window as sent by
+// the server, and fieldSchema the part of it holding the included fields, and the key fields if keepKeyFields is set,
+// which events are laid out by.
 type subscription struct {
-	schema         map[string]field.SchemaType
+	projectName    string
+	request        messagedto.StreamMessageDTO
+	schema         *field.Schema
+	fieldSchema    *field.Schema
 	format         string
 	includedFields []string
+	keepKeyFields  bool
+	handle         *Subscription
+}
+
+// ServerError is an error message sent by the ESP server. SubscriptionId is empty unless the error refers to a
+// particular subscription.
+type ServerError struct {
+	SubscriptionId string
+	Message        string
+}
+
+func (e *ServerError) Error() string {
+	return e.Message
+}
+
+var ErrClientNotRunning = errors.New("ESP client is not running")
+
+type connMessageKind int
+
+const (
+	connMessageOpened connMessageKind = iota
+	connMessageReceived
+	connMessageClosed
+)
+
+// connMessage carries a connection's state changes and messages into the event loop. The generation identifies the
+// connection the message originates from, so that messages of connections replaced by a reconnection are ignored.
+type connMessage struct {
+	generation int
+	kind       connMessageKind
+	conn       transport.Connection
+	message    transport.Message
+	err        error
 }
 
 type messageType int
@@ -58,124 +117,306 @@ const (
 	MessageTypeInfoDiscard
 )
 
-const jsonFormat string = "json"
-const cborFormat string = "cbor"
+// Formats in which the server can encode the events of a subscription.
+const JsonFormat string = "json"
+const CborFormat string = "cbor"
+
+const eventBufferSize = 64
+const incomingBufferSize = 64
 
 func New(wsConnectionUrl url.URL, authorizationHeader *string) *EspWsClient {
-	socket := gowebsocket.New(wsConnectionUrl.String())
+	requestHeader := http.Header{}
 	if authorizationHeader != nil {
-		socket.RequestHeader.Set("Authorization", *authorizationHeader)
+		requestHeader.Set("Authorization", *authorizationHeader)
 	}
 
 	espWsClient := EspWsClient{
-		socket:        &socket,
-		isConnected:   false,
+		url:           wsConnectionUrl,
+		requestHeader: requestHeader,
+		done:          make(chan struct{}),
+		commands:      make(chan func()),
+		incoming:      make(chan connMessage, incomingBufferSize),
+		events:        make(chan Event, eventBufferSize),
 		subscriptions: make(map[string]*subscription),
-		Errors:        make(chan error),
+		Backoff:       DefaultBackoff,
+		Transport:     transport.WebsocketTransport{},
 	}
 
-	socket.OnConnected = handleConnect
-	socket.OnConnectError = getConnectionErrorHandler(&espWsClient)
-	socket.OnTextMessage = getTextMessageHandler(&espWsClient)
-	socket.OnBinaryMessage = getBinaryMessageHandler(&espWsClient)
-	socket.OnDisconnected = getDisconnectHandler(&espWsClient)
-
 	return &espWsClient
 }
 
-func handleConnect(socket gowebsocket.Socket) {
-	log.DefaultLogger.Debug(fmt.Sprintf("Opened WebSocket: %s", socket.Url))
+// Connect starts the event loop, which keeps the connection open until the context is cancelled or Close is called.
+// Subsequent calls have no effect.
+func (espWsClient *EspWsClient) Connect(ctx context.Context) {
+	if !espWsClient.started.CompareAndSwap(false, true) {
+		return
+	}
+
+	espWsClient.ctx, espWsClient.cancel = context.WithCancel(ctx)
+	go espWsClient.run(espWsClient.ctx)
+}
+
+// Events returns the channel of connection-wide events.
+func (espWsClient *EspWsClient) Events() <-chan Event {
+	return espWsClient.events
 }
 
-func getConnectionErrorHandler(espWsClient *EspWsClient) func(err error, socket gowebsocket.Socket) {
-	return func(err error, socket gowebsocket.Socket) {
-		log.DefaultLogger.Error(fmt.Sprintf("WebSocket error: %s, %s", socket.Url, err))
-		espWsClient.handleConnectionError()
+// Close stops the event loop and waits for the connection to be closed.
+func (espWsClient *EspWsClient) Close() {
+	if !espWsClient.started.Load() {
+		return
 	}
+
+	espWsClient.cancel()
+	<-espWsClient.done
 }
 
-func getTextMessageHandler(espWsClient *EspWsClient) func(messageString string, socket gowebsocket.Socket) {
-	return func(messageString string, socket gowebsocket.Socket) {
-		if !espWsClient.isConnected {
-			isHandshakeMessage := !espWsClient.isConnected && strings.HasPrefix(messageString, "status: 200\n")
-			if isHandshakeMessage {
-				espWsClient.handleHandshakeSuccessful()
-				return
-			}
+func (espWsClient *EspWsClient) run(ctx context.Context) {
+	defer close(espWsClient.done)
+	defer close(espWsClient.events)
+	defer espWsClient.closeSubscriptions()
+	defer espWsClient.closeConnection()
+
+	espWsClient.dial(ctx)
+
+	for {
+		var reconnectC <-chan time.Time
+		if espWsClient.reconnectTimer != nil {
+			reconnectC = espWsClient.reconnectTimer.C
 		}
 
-		messageBytes := []byte(messageString)
-		var message messagedto.MessageDTO
-		err := json.Unmarshal(messageBytes, &message)
-		if err != nil {
-			log.DefaultLogger.Error(fmt.Sprintf("Cannot unmarshal messageString: %s", messageString))
+		select {
+		case <-ctx.Done():
+			if espWsClient.reconnectTimer != nil {
+				espWsClient.reconnectTimer.Stop()
+			}
 			return
+		case command := <-espWsClient.commands:
+			command()
+		case message := <-espWsClient.incoming:
+			espWsClient.handleConnMessage(message)
+		case <-reconnectC:
+			espWsClient.reconnectTimer = nil
+			espWsClient.dial(ctx)
 		}
+	}
+}
+
+// do executes a function on the event loop and waits for its completion.
+func (espWsClient *EspWsClient) do(f func()) error {
+	if !espWsClient.started.Load() {
+		return ErrClientNotRunning
+	}
 
-		espWsClient.handleMessage(message, messageBytes)
+	completed := make(chan struct{})
+	select {
+	case espWsClient.commands <- func() {
+		f()
+		close(completed)
+	}:
+	case <-espWsClient.done:
+		return ErrClientNotRunning
 	}
+
+	<-completed
+	return nil
 }
 
-func getBinaryMessageHandler(espWsClient *EspWsClient) func(data []byte, socket gowebsocket.Socket) {
-	return func(data []byte, socket gowebsocket.Socket) {
-		if !espWsClient.isConnected {
-			messageString := string(data)[:]
-			isHandshakeMessage := !espWsClient.isConnected && strings.HasPrefix(messageString, "status: 200\n")
-			if isHandshakeMessage {
-				espWsClient.handleHandshakeSuccessful()
-				return
-			}
+// dial opens a new connection in the background. Messages received on it are forwarded to the event loop.
+func (espWsClient *EspWsClient) dial(ctx context.Context) {
+	espWsClient.connGeneration++
+	generation := espWsClient.connGeneration
+
+	post := func(message connMessage) bool {
+		message.generation = generation
+		select {
+		case espWsClient.incoming <- message:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	go func() {
+		conn, err := espWsClient.Transport.Dial(ctx, espWsClient.url, espWsClient.requestHeader.Clone())
+		if err != nil {
+			log.DefaultLogger.Error(fmt.Sprintf("WebSocket error: %s, %s", espWsClient.url.String(), err))
+			post(connMessage{kind: connMessageClosed, err: err})
+			return
+		}
+
+		log.DefaultLogger.Debug(fmt.Sprintf("Opened WebSocket: %s", espWsClient.url.String()))
+		if !post(connMessage{kind: connMessageOpened, conn: conn}) {
+			_ = conn.Close()
+			return
 		}
 
-		var message *messagedto.MessageDTO
-		if isBinaryMessageCborEncoded(&data) {
-			var err error
-			message, err = decodeCborMessage(&data)
+		for {
+			message, err := conn.Read()
 			if err != nil {
-				log.DefaultLogger.Error(fmt.Sprintf("Cannot unmarshal CBOR message: %v", data))
+				log.DefaultLogger.Debug(fmt.Sprintf("WebSocket closed: %v, %v", espWsClient.url.String(), err))
+				post(connMessage{kind: connMessageClosed, err: err})
 				return
 			}
-		} else {
-			message = new(messagedto.MessageDTO)
-			err := json.Unmarshal(data, message)
-			if err != nil {
-				log.DefaultLogger.Error(fmt.Sprintf("Cannot unmarshal message: %v", data))
+
+			if !post(connMessage{kind: connMessageReceived, message: message}) {
 				return
 			}
 		}
+	}()
+}
 
-		espWsClient.handleMessage(*message, data)
+func (espWsClient *EspWsClient) closeConnection() {
+	conn := espWsClient.conn
+	espWsClient.conn = nil
+	espWsClient.isConnected = false
+	if conn == nil {
+		return
 	}
+
+	_ = conn.Close()
 }
 
-func getDisconnectHandler(espWsClient *EspWsClient) func(err error, socket gowebsocket.Socket) {
-	return func(err error, socket gowebsocket.Socket) {
-		log.DefaultLogger.Debug(fmt.Sprintf("WebSocket closed: %v, %v", socket.Url, err))
-		espWsClient.handleConnectionClosed()
+func (espWsClient *EspWsClient) handleConnMessage(message connMessage) {
+	if message.generation != espWsClient.connGeneration {
+		if message.kind == connMessageOpened {
+			_ = message.conn.Close()
+		}
+		return
+	}
 
-		if err != nil {
-			espWsClient.handleConnectionError()
+	switch message.kind {
+	case connMessageOpened:
+		espWsClient.conn = message.conn
+	case connMessageReceived:
+		if message.message.Binary {
+			espWsClient.handleBinaryMessage(message.message.Data)
+		} else {
+			espWsClient.handleTextMessage(message.message.Data)
 		}
+	case connMessageClosed:
+		wasConnected := espWsClient.isConnected
+		espWsClient.closeConnection()
+		if wasConnected {
+			espWsClient.emit(ConnectionStateChanged{State: ConnectionStateDisconnected})
+		}
+		espWsClient.scheduleReconnect()
+	}
+}
+
+// closeSubscriptions closes the event channels of all subscriptions once the event loop stops.
+func (espWsClient *EspWsClient) closeSubscriptions() {
+	for subscriptionId, sub := range espWsClient.subscriptions {
+		sub.handle.close()
+		delete(espWsClient.subscriptions, subscriptionId)
 	}
 }
 
-func (espWsClient *EspWsClient) handleDisconnect() {
-	espWsClient.socket.Connect()
+// emit passes a connection-wide event to Events, blocking until it is received or the client is stopped.
+func (espWsClient *EspWsClient) emit(event Event) {
+	select {
+	case espWsClient.events <- event:
+	case <-espWsClient.ctx.Done():
+	}
 }
 
-func (espWsClient *EspWsClient) Connect() {
-	espWsClient.socket.Connect()
+// emitToSubscription queues an event for the subscription's Events without blocking the event loop.
+func (espWsClient *EspWsClient) emitToSubscription(sub *subscription, event Event) {
+	sub.handle.enqueue(event)
 }
 
-func (espWsClient *EspWsClient) Close() {
-	if espWsClient.socket.Conn != nil {
-		espWsClient.socket.Close()
-		espWsClient.handleConnectionClosed()
+func (espWsClient *EspWsClient) handleTextMessage(messageBytes []byte) {
+	if !espWsClient.isConnected {
+		isHandshakeMessage := strings.HasPrefix(string(messageBytes), "status: 200\n")
+		if isHandshakeMessage {
+			espWsClient.handleHandshakeSuccessful()
+			return
+		}
+	}
+
+	var message messagedto.MessageDTO
+	err := json.Unmarshal(messageBytes, &message)
+	if err != nil {
+		log.DefaultLogger.Error(fmt.Sprintf("Cannot unmarshal messageString: %s", messageBytes))
+		return
+	}
+
+	espWsClient.handleMessage(message, messageBytes)
+}
+
+func (espWsClient *EspWsClient) handleBinaryMessage(data []byte) {
+	if !espWsClient.isConnected {
+		isHandshakeMessage := strings.HasPrefix(string(data), "status: 200\n")
+		if isHandshakeMessage {
+			espWsClient.handleHandshakeSuccessful()
+			return
+		}
+	}
+
+	var message *messagedto.MessageDTO
+	if isBinaryMessageCborEncoded(&data) {
+		var err error
+		message, err = decodeCborMessage(&data)
+		if err != nil {
+			log.DefaultLogger.Error(fmt.Sprintf("Cannot unmarshal CBOR message: %v", data))
+			return
+		}
+	} else {
+		message = new(messagedto.MessageDTO)
+		err := json.Unmarshal(data, message)
+		if err != nil {
+			log.DefaultLogger.Error(fmt.Sprintf("Cannot unmarshal message: %v", data))
+			return
+		}
 	}
+
+	espWsClient.handleMessage(*message, data)
 }
 
-func (espWsClient *EspWsClient) Subscribe(projectName string, cqName string, windowName string, interval uint64, maxEvents uint64, fields []string) error {
-	subscriptionFormat := cborFormat
+// scheduleReconnect re-establishes a dropped connection after a backoff delay.
+func (espWsClient *EspWsClient) scheduleReconnect() {
+	if espWsClient.reconnectTimer != nil {
+		return
+	}
+
+	espWsClient.reconnectAttempt++
+	attempt := espWsClient.reconnectAttempt
+	delay := espWsClient.Backoff.Delay(attempt)
+	log.DefaultLogger.Info("Reconnecting to ESP server", "url", espWsClient.url.String(), "attempt", attempt, "delay", delay)
+
+	espWsClient.reconnectTimer = time.NewTimer(delay)
+
+	espWsClient.emit(ConnectionStateChanged{
+		State:            ConnectionStateReconnecting,
+		ReconnectAttempt: attempt,
+		ReconnectDelay:   delay,
+	})
+}
+
+// reportError emits an error to the affected subscription only. Errors that do not concern a known subscription, such
+// as those of cancelled subscriptions, are logged instead, as they must not fail the streams of other subscriptions.
+func (espWsClient *EspWsClient) reportError(subscriptionId string, err error) {
+	sub, ok := espWsClient.subscriptions[subscriptionId]
+	if !ok {
+		log.DefaultLogger.Error("received error without known subscription id", "subscriptionId", subscriptionId, "error", err)
+		return
+	}
+
+	espWsClient.emitToSubscription(sub, ErrorReceived{SubscriptionId: subscriptionId, Err: err})
+}
+
+// Subscribe registers an event-stream subscription, whose schema, events and errors are emitted on the returned
+// subscription's Events. The subscription is sent immediately if the connection has been established and is
+// replayed after every successful handshake, including those following a reconnection. The format is either
+// JsonFormat or CborFormat, and defaults to CborFormat when empty. If keepKeyFields is set, the key fields of the window
+// are delivered along with the given fields. As the key fields are only known once the schema has been received, all
+// fields are then requested from the server.
+func (espWsClient *EspWsClient) Subscribe(projectName string, cqName string, windowName string, interval uint64, maxEvents uint64, fields []string, format string, keepKeyFields bool) (*Subscription, error) {
+	subscriptionFormat, err := ParseFormat(format)
+	if err != nil {
+		return nil, err
+	}
+
 	windowPath := fmt.Sprintf("%s/%s/%s", projectName, cqName, windowName)
 	subscriptionId := fmt.Sprintf("%s/%s", windowPath, uuid.New().String())
 	eventStream := messagedto.StreamMessageDTO{
@@ -187,9 +428,106 @@ func (espWsClient *EspWsClient) Subscribe(projectName string, cqName string, win
 		Format:        subscriptionFormat,
 		Interval:      interval,
 		MaxEvents:     maxEvents,
-		IncludeFields: fields,
+		IncludeFields: requestedFields(fields, keepKeyFields),
+	}
+
+	sub := new(subscription)
+	sub.projectName = projectName
+	sub.request = eventStream
+	sub.format = subscriptionFormat
+	sub.includedFields = fields
+	sub.keepKeyFields = keepKeyFields
+	sub.handle = newSubscription(espWsClient, subscriptionId)
+
+	doErr := espWsClient.do(func() {
+		espWsClient.subscriptions[subscriptionId] = sub
+		if espWsClient.isConnected {
+			err = espWsClient.sendSubscription(sub.request)
+		}
+	})
+	if doErr != nil {
+		return nil, doErr
+	}
+
+	return sub.handle, err
+}
+
+// requestedFields returns the fields to request from the server for the given included fields.
+func requestedFields(fields []string, keepKeyFields bool) []string {
+	if keepKeyFields {
+		return nil
+	}
+
+	return fields
+}
+
+// ParseFormat validates a subscription format name. The empty string selects the default, CborFormat.
+func ParseFormat(format string) (string, error) {
+	switch strings.ToLower(format) {
+	case "", CborFormat:
+		return CborFormat, nil
+	case JsonFormat:
+		return JsonFormat, nil
+	default:
+		return "", fmt.Errorf("unsupported subscription format: %s", format)
+	}
+}
+
+func (espWsClient *EspWsClient) updateSubscription(subscriptionId string, interval uint64, maxEvents uint64, fields []string) error {
+	var err error
+	doErr := espWsClient.do(func() {
+		sub, ok := espWsClient.subscriptions[subscriptionId]
+		if !ok {
+			err = fmt.Errorf("subscription not found: %s", subscriptionId)
+			return
+		}
+
+		sub.request.Interval = interval
+		sub.request.MaxEvents = maxEvents
+		sub.request.IncludeFields = requestedFields(fields, sub.keepKeyFields)
+		sub.includedFields = fields
+		// A new schema message is sent by the server for the updated subscription.
+		sub.schema = nil
+		sub.fieldSchema = nil
+
+		if espWsClient.isConnected {
+			err = espWsClient.sendSubscription(sub.request)
+		}
+	})
+	if doErr != nil {
+		return doErr
 	}
 
+	return err
+}
+
+func (espWsClient *EspWsClient) cancelSubscription(subscriptionId string) error {
+	var err error
+	doErr := espWsClient.do(func() {
+		sub, ok := espWsClient.subscriptions[subscriptionId]
+		if !ok {
+			return
+		}
+
+		delete(espWsClient.subscriptions, subscriptionId)
+		sub.handle.close()
+
+		if espWsClient.isConnected {
+			err = espWsClient.sendSubscription(messagedto.StreamMessageDTO{
+				Action: "delete",
+				Id:     subscriptionId,
+			})
+		}
+	})
+	if errors.Is(doErr, ErrClientNotRunning) {
+		// Subscriptions of a stopped client no longer exist on the server.
+		return nil
+	}
+
+	return err
+}
+
+func (espWsClient *EspWsClient) sendSubscription(eventStream messagedto.StreamMessageDTO) error {
 	subscriptionMessage := messagedto.SubscriptionMessageDTO{
 		EventStream: eventStream,
 	}
@@ -199,22 +537,50 @@ func (espWsClient *EspWsClient) Subscribe(projectName string, cqName string, win
 		return err
 	}
 
-	sub := new(subscription)
-	sub.format = subscriptionFormat
-	sub.includedFields = fields
-	espWsClient.subscriptions[subscriptionId] = sub
+	err = espWsClient.conn.WriteText(subscriptionMessageBytes)
+	if err != nil {
+		return err
+	}
 
-	espWsClient.socket.SendText(string(subscriptionMessageBytes))
-	log.DefaultLogger.Debug(fmt.Sprintf("Subscribed to: %s", subscriptionMessageBytes))
+	log.DefaultLogger.Debug(fmt.Sprintf("Sent event-stream request: %s", subscriptionMessageBytes))
 
 	return nil
 }
 
+// resubscribe replays every active subscription, optionally restricted to the windows of a single project.
+func (espWsClient *EspWsClient) resubscribe(projectName *string) {
+	for _, sub := range espWsClient.subscriptions {
+		if projectName != nil && sub.projectName != *projectName {
+			continue
+		}
+
+		sub.schema = nil
+		sub.fieldSchema = nil
+		err := espWsClient.sendSubscription(sub.request)
+		if err != nil {
+			log.DefaultLogger.Error("error while resubscribing", "subscriptionId", sub.request.Id, "error", err)
+			continue
+		}
+		espWsClient.emitToSubscription(sub, Resubscribed{SubscriptionId: sub.request.Id})
+	}
+}
+
+// handleBulkMessage handles the messages wrapped in a bulk message. Consecutive events messages of the same
+// subscription are handled as one, so that their events are emitted together.
 func (espWsClient *EspWsClient) handleBulkMessage(encodedMessages *[]string) {
 	if encodedMessages == nil {
 		return
 	}
 
+	var pendingEvents *messagedto.EventMessageDTO
+	flushPendingEvents := func() {
+		if pendingEvents != nil {
+			espWsClient.handleEventMessage(pendingEvents)
+			pendingEvents = nil
+		}
+	}
+	defer flushPendingEvents()
+
 	for _, encodedString := range *encodedMessages {
 		decodedMessage, err := decodeBulkMessageString(encodedString)
 		if err != nil {
@@ -229,6 +595,18 @@ func (espWsClient *EspWsClient) handleBulkMessage(encodedMessages *[]string) {
 			return
 		}
 
+		if espWsClient.determineMessageType(&message) == MessageTypeEvent {
+			if pendingEvents != nil && pendingEvents.SubscriptionId == message.Events.SubscriptionId {
+				pendingEvents.Entries = append(pendingEvents.Entries, message.Events.Entries...)
+				continue
+			}
+
+			flushPendingEvents()
+			pendingEvents = message.Events
+			continue
+		}
+
+		flushPendingEvents()
 		espWsClient.handleMessage(message, *decodedMessage)
 	}
 }
@@ -285,69 +663,130 @@ func (espWsClient *EspWsClient) handleMessage(message messagedto.MessageDTO, mes
 		messageData := message.Info.Data
 		formattedMessage := fmt.Sprintf("Events discarded: %d out of %d", messageData.Discarded, messageData.Total)
 		log.DefaultLogger.Info(fmt.Sprintf("Received 'info' message: %s", formattedMessage))
+		espWsClient.emit(EventsDiscarded{Discarded: messageData.Discarded, Total: messageData.Total})
 	default:
 		log.DefaultLogger.Error(fmt.Sprintf("Unknown message type received. Message: %s", messageBytes))
 	}
 }
 
 func (espWsClient *EspWsClient) handleSchemaMessage(message *messagedto.SchemaMessageDTO) {
-	fieldTypeMap := make(map[string]field.SchemaType)
+	sub, ok := espWsClient.subscriptions[message.SubscriptionId]
+	if !ok {
+		log.DefaultLogger.Error("received schema with unknown subscription id", "subscriptionId", message.SubscriptionId)
+		return
+	}
+
+	sub.schema = parseSchema(message)
+	sub.fieldSchema = sub.schema.Select(sub.selectedFields())
+	espWsClient.emitToSubscription(sub, SchemaReceived{SubscriptionId: message.SubscriptionId, Schema: sub.fieldSchema})
+}
+
+// selectedFields returns the names of the fields that events of the subscription are laid out by.
+func (sub *subscription) selectedFields() []string {
+	if !sub.keepKeyFields || len(sub.includedFields) == 0 {
+		return sub.includedFields
+	}
+
+	fields := slices.Clone(sub.includedFields)
+	for _, keyField := range sub.schema.KeyFields() {
+		if !slices.Contains(fields, keyField.Name) {
+			fields = append(fields, keyField.Name)
+		}
+	}
+
+	return fields
+}
+
+// parseSchema returns the schema described by a schema message.
+func parseSchema(message *messagedto.SchemaMessageDTO) *field.Schema {
+	schemaFields := make([]*field.SchemaField, 0, len(message.Fields))
 	for _, f := range message.Fields {
-		var ft field.SchemaType
-		ft, err := field.ParseFieldTypeFromString(f.Type)
+		schemaType, err := field.ParseFieldTypeFromString(f.Type)
 		if err != nil {
-			espWsClient.Errors <- err
-			return
+			// Values of fields of unknown type are still delivered, as strings.
+			log.DefaultLogger.Warn("Unsupported schema field type", "subscriptionId", message.SubscriptionId, "field", f.Name, "type", f.Type)
+		}
+
+		precision := -1
+		if f.Precision != "" {
+			parsedPrecision, err := strconv.Atoi(f.Precision)
+			if err == nil {
+				precision = parsedPrecision
+			}
 		}
 
-		fieldTypeMap[f.Name] = ft
+		schemaFields = append(schemaFields, &field.SchemaField{
+			Name:      f.Name,
+			Type:      schemaType,
+			TypeName:  f.Type,
+			Precision: precision,
+			Key:       strings.EqualFold(f.Key, "true"),
+		})
 	}
 
-	espWsClient.subscriptions[message.SubscriptionId].schema = fieldTypeMap
+	return field.NewSchema(schemaFields)
 }
 
 func (espWsClient *EspWsClient) handleErrorMessage(message *messagedto.ErrorMessageDTO) {
 	log.DefaultLogger.Error(fmt.Sprintf("Received error message: %v", message))
 
-	espWsClient.Errors <- fmt.Errorf(message.Text)
+	espWsClient.reportError(message.Id, &ServerError{SubscriptionId: message.Id, Message: message.Text})
 }
 
+// handleEventMessage emits the events of an events message that can be parsed as a single WindowEventsReceived.
 func (espWsClient *EspWsClient) handleEventMessage(message *messagedto.EventMessageDTO) {
 	subscriptionId := message.SubscriptionId
 
 	log.DefaultLogger.Debug(fmt.Sprintf("Received event message, entries: %d", len(message.Entries)))
 
+	sub, ok := espWsClient.subscriptions[subscriptionId]
+	if !ok {
+		log.DefaultLogger.Error("received event with unknown subscription id", "subscriptionId", subscriptionId)
+		return
+	}
+
+	windowEvents := make([]windowevent.WindowEvent, 0, len(message.Entries))
 	for _, value := range message.Entries {
-		espWsClient.handleEvent(subscriptionId, value)
+		windowEvent := espWsClient.handleEvent(sub, value)
+		if windowEvent != nil {
+			windowEvents = append(windowEvents, *windowEvent)
+		}
 	}
-}
 
-func (espWsClient *EspWsClient) handleEvent(subscriptionId string, event messagedto.EventEntryDTO) {
-	if event == nil {
-		log.DefaultLogger.Warn("received nil event", "subscriptionId", subscriptionId)
+	if len(windowEvents) == 0 {
 		return
 	}
 
-	sub, ok := espWsClient.subscriptions[subscriptionId]
-	if !ok {
-		log.DefaultLogger.Error("received event with unknown subscription id", "subscriptionId", subscriptionId)
-		return
+	espWsClient.emitToSubscription(sub, WindowEventsReceived{SubscriptionId: subscriptionId, WindowEvents: windowEvents})
+}
+
+// handleEvent parses an event entry of the subscription. Nil is returned if the entry cannot be parsed.
+func (espWsClient *EspWsClient) handleEvent(sub *subscription, event messagedto.EventEntryDTO) *windowevent.WindowEvent {
+	subscriptionId := sub.request.Id
+
+	if event == nil {
+		log.DefaultLogger.Warn("received nil event", "subscriptionId", subscriptionId)
+		return nil
 	}
 
 	//JSON API spec inconsistency #1: event structure is unnecessarily nested inside an extra event field, unlike CBOR.
-	if sub.format == jsonFormat {
-		event = event["event"].(messagedto.EventEntryDTO)
+	if sub.format == JsonFormat {
+		nestedEvent, ok := event["event"].(messagedto.EventEntryDTO)
+		if !ok {
+			espWsClient.countDecodeError(newDecodeError(DecodeErrorMalformedEvent, "", "JSON event is not nested in an event field"))
+			log.DefaultLogger.Error("received JSON event without nested event", "subscriptionId", subscriptionId)
+			return nil
+		}
+		event = nestedEvent
 	}
 
 	windowEvent, err := espWsClient.parseWindowEvent(event, sub)
 	if err != nil {
-		log.DefaultLogger.Error("error while parsing window event", "error", err)
-		return
+		log.DefaultLogger.Error("error while parsing window event", "subscriptionId", subscriptionId, "error", err)
+		return nil
 	}
 
-	if espWsClient.OnEventMessageReceived != nil {
-		espWsClient.OnEventMessageReceived(*windowEvent)
-	}
+	return windowEvent
 }
 
 func (espWsClient *EspWsClient) parseWindowEvent(event messagedto.EventEntryDTO, sub *subscription) (*windowevent.WindowEvent, error) {
@@ -355,20 +794,21 @@ func (espWsClient *EspWsClient) parseWindowEvent(event messagedto.EventEntryDTO,
 	eventTimestampRaw := event["@timestamp"]
 	eventTime, err := windowevent.ParseWindowEventTime(eventTimestampRaw)
 	if err != nil {
-		err := fmt.Errorf("error while parsing window event timestamp (%v): %s", eventTimestampRaw, err.Error())
-		return nil, err
+		decodeError := newDecodeError(DecodeErrorMalformedEvent, "", "invalid event timestamp (%v): %s", eventTimestampRaw, err.Error())
+		espWsClient.countDecodeError(decodeError)
+		return nil, decodeError
 	}
 
 	eventOpcodeRaw := event["@opcode"]
 	eventOpcode, ok := eventOpcodeRaw.(string)
 	if !ok {
-		err := fmt.Errorf("unexpected value type %T for event opcode: %v", eventOpcodeRaw, eventOpcodeRaw)
-		return nil, err
+		decodeError := newDecodeError(DecodeErrorMalformedEvent, "", "unexpected value type %T for event opcode: %v", eventOpcodeRaw, eventOpcodeRaw)
+		espWsClient.countDecodeError(decodeError)
+		return nil, decodeError
 	}
 
 	fields, err := espWsClient.parseEventFields(event, sub)
 	if err != nil {
-		err := fmt.Errorf("error while parsing window event fields: %s", err.Error())
 		return nil, err
 	}
 
@@ -376,263 +816,384 @@ func (espWsClient *EspWsClient) parseWindowEvent(event messagedto.EventEntryDTO,
 	return &windowEvent, nil
 }
 
+// parseEventFields decodes the fields of an event in the order of the included fields of the schema. Included fields
+// that the event lacks are left out, as updates may carry only the fields that changed, while fields holding null are
+// kept. Fields that cannot be decoded are handled according to the decode error policy of the client, as are fields
+// that are not part of the schema.
 func (espWsClient *EspWsClient) parseEventFields(event messagedto.EventEntryDTO, sub *subscription) (*[]field.Field, error) {
-	fieldNames := make([]string, 0, len(event))
+	unknownFieldNames := make([]string, 0)
 	for key := range event {
 		if field.IsFieldNameInternal(key) {
 			continue
 		}
 
-		fieldNames = append(fieldNames, key)
+		if sub.schema != nil {
+			if _, ok := sub.schema.Field(key); ok {
+				continue
+			}
+		}
+
+		unknownFieldNames = append(unknownFieldNames, key)
 	}
 
-	sort.Strings(fieldNames)
+	sort.Strings(unknownFieldNames)
 
-	fields := make([]field.Field, 0, len(fieldNames))
-	for _, fieldName := range fieldNames {
-		fieldValueRaw, ok := event[fieldName]
-		if !ok {
-			err := fmt.Errorf("field '%s' not found in event", fieldName)
+	for _, fieldName := range unknownFieldNames {
+		var err *DecodeError
+		if sub.schema == nil {
+			err = newDecodeError(DecodeErrorMissingSchema, fieldName, "no schema received")
+		} else {
+			err = newDecodeError(DecodeErrorMissingSchema, fieldName, "no schema type found")
+		}
+
+		espWsClient.countDecodeError(err)
+		log.DefaultLogger.Debug("Unable to decode event field", "subscriptionId", sub.request.Id, "error", err)
+
+		if espWsClient.DecodeErrorPolicy == DecodeErrorPolicySkipEvent {
 			return nil, err
 		}
+	}
+
+	fields := make([]field.Field, 0)
+	if sub.fieldSchema == nil {
+		return &fields, nil
+	}
 
-		schemaType, schemaError := espWsClient.getSchemaFieldType(sub, fieldName)
-		if schemaError != nil {
-			return nil, schemaError
+	for _, schemaField := range sub.fieldSchema.Fields {
+		rawValue, ok := event[schemaField.Name]
+		if !ok {
+			continue
 		}
 
-		validationError := espWsClient.validateField(fieldName, fieldValueRaw, sub, *schemaType)
-		if validationError != nil {
-			err := fmt.Errorf("invalid field: %s", validationError.Error())
-			return nil, err
+		fieldValue, err := parseField(schemaField, rawValue, sub.format)
+		if err == nil {
+			fields = append(fields, field.FromSchema(schemaField, fieldValue))
+			continue
 		}
 
-		fieldValue, fieldValueError := parseFieldValue(fieldValueRaw, sub, *schemaType)
-		if fieldValueError != nil {
-			err := fmt.Errorf("invalid field value: %s", fieldValueError)
+		espWsClient.countDecodeError(err)
+		log.DefaultLogger.Debug("Unable to decode event field", "subscriptionId", sub.request.Id, "error", err)
+
+		switch espWsClient.DecodeErrorPolicy {
+		case DecodeErrorPolicySkipEvent:
 			return nil, err
+		case DecodeErrorPolicySkipField:
+			continue
+		default:
+			fields = append(fields, field.FromSchema(schemaField, nullFieldValue(schemaField.Type)))
 		}
-
-		f := field.New(fieldName, fieldValue)
-		fields = append(fields, f)
 	}
 
 	return &fields, nil
 }
 
-func parseFieldValue(rawValue any, sub *subscription, schemaType field.SchemaType) (any, error) {
-	var fieldValue any
+// parseField decodes the value of a field of the given schema. Null values are decoded as nulls.
+func parseField(schemaField *field.SchemaField, rawValue any, format string) (any, *DecodeError) {
+	if rawValue == nil {
+		return nullFieldValue(schemaField.Type), nil
+	}
+
 	//JSON API spec inconsistency #2: unlike CBOR structure, all field values are returned as a string regardless of schema type
-	if sub.format == jsonFormat {
-		value := parseJsonFieldValue(rawValue, schemaType)
-		return &value, nil
+	if format == JsonFormat {
+		return parseJsonFieldValue(schemaField.Name, rawValue, schemaField.Type)
 	}
 
-	switch schemaType {
-	case field.Array:
-		rawArray := rawValue.([]any)
-		ptrArray := make([]*any, 0, len(rawArray))
-		for i := range rawArray {
-			c := rawArray[i]
-			var ptr *any
-			if floatValue, isFloat := c.(float64); isFloat && math.IsNaN(floatValue) || c == nil {
-				ptr = nil
-			} else {
-				ptr = &rawArray[i]
-			}
+	return parseFieldValue(schemaField.Name, rawValue, schemaField.Type)
+}
 
-			ptrArray = append(ptrArray, ptr)
+func parseFieldValue(fieldName string, rawValue any, schemaType field.SchemaType) (any, *DecodeError) {
+	switch schemaType {
+	case field.Int32:
+		if value, ok := toInt64(rawValue); ok && value >= math.MinInt32 && value <= math.MaxInt32 {
+			return int32(value), nil
 		}
-
-		var err error
-		fieldValue, err = json.Marshal(ptrArray)
-		if err != nil {
-			return nil, err
+	case field.Int64:
+		// CBOR encodes non-negative integers as unsigned, they are normalised to match the JSON format.
+		if value, ok := toInt64(rawValue); ok {
+			return value, nil
+		}
+	case field.Double:
+		if value, ok := toFloat64(rawValue); ok {
+			return value, nil
+		}
+	case field.Money:
+		if value, ok := toFloat64(rawValue); ok {
+			return value, nil
+		}
+		if value, ok := rawValue.(string); ok {
+			return parseMoney(fieldName, value)
+		}
+	case field.ArrayDouble, field.ArrayInt32, field.ArrayInt64:
+		if rawArray, ok := rawValue.([]any); ok {
+			return parseArray(fieldName, rawArray, schemaType)
+		}
+	case field.String, field.RString:
+		if value, ok := rawValue.(string); ok {
+			return value, nil
 		}
-		fieldValue = json.RawMessage(fieldValue.([]byte))
-	case field.Blob:
-		fieldValue = base64.StdEncoding.EncodeToString(rawValue.([]byte))
 	case field.Timestamp:
-		signed := int64(rawValue.(uint64))
-		fieldValue = time.UnixMicro(signed)
+		if value, ok := toInt64(rawValue); ok {
+			return time.UnixMicro(value), nil
+		}
 	case field.Date:
-		signed := int64(rawValue.(uint64))
-		fieldValue = time.Unix(signed, 0)
+		if value, ok := toInt64(rawValue); ok {
+			return time.Unix(value, 0), nil
+		}
+	case field.Blob:
+		if blob, ok := rawValue.([]byte); ok {
+			return field.NewBlobValue(blob, ""), nil
+		}
 	default:
-		fieldValue = rawValue
+		return stringifyValue(rawValue), nil
 	}
-	return fieldValue, nil
+
+	return nil, newTypeMismatchError(fieldName, rawValue, schemaType)
 }
 
-func parseJsonFieldValue(rawValue any, schemaType field.SchemaType) any {
+func parseJsonFieldValue(fieldName string, rawValue any, schemaType field.SchemaType) (any, *DecodeError) {
 	var fieldValueString string
+	var blobTypeHint string
+	var ok bool
 	if schemaType == field.Blob {
-		fieldValueString = rawValue.(map[string]any)["*value"].(string)
+		//JSON API spec inconsistency #3: unlike CBOR, blob values are contained within a string map. The map has two keys:
+		// - @type, providing the file signature, used as a content type hint when the body has no known magic bytes
+		// - value, holding a base64-encoded string of the actual blob data
+		var blob map[string]any
+		blob, ok = rawValue.(map[string]any)
+		if ok {
+			fieldValueString, ok = blob["*value"].(string)
+			blobTypeHint, _ = blob["@type"].(string)
+		}
 	} else {
-		fieldValueString = rawValue.(string)
+		fieldValueString, ok = rawValue.(string)
 	}
+	if !ok {
+		if schemaType == field.Unknown {
+			return stringifyValue(rawValue), nil
+		}
 
-	var err error
-	var fieldValue any
+		return nil, newTypeMismatchError(fieldName, rawValue, schemaType)
+	}
 
 	switch schemaType {
-	case field.Blob:
-		fieldValue = fieldValueString
+	case field.Int32:
+		fieldValue, err := strconv.ParseInt(fieldValueString, 10, 32)
+		if err != nil {
+			return nil, newDecodeError(DecodeErrorTypeMismatch, fieldName, "cannot convert field value to type int32: %s", fieldValueString)
+		}
+
+		return int32(fieldValue), nil
+	case field.Int64:
+		fieldValue, err := strconv.ParseInt(fieldValueString, 10, 64)
+		if err != nil {
+			return nil, newDecodeError(DecodeErrorTypeMismatch, fieldName, "cannot convert field value to type int64: %s", fieldValueString)
+		}
+
+		return fieldValue, nil
 	case field.Double:
-		fieldValue, err = strconv.ParseFloat(fieldValueString, 64)
+		fieldValue, err := strconv.ParseFloat(fieldValueString, 64)
+		if err != nil {
+			return nil, newDecodeError(DecodeErrorTypeMismatch, fieldName, "cannot convert field value to type double: %s", fieldValueString)
+		}
+
+		return fieldValue, nil
+	case field.Money:
+		return parseMoney(fieldName, fieldValueString)
+	case field.ArrayDouble, field.ArrayInt32, field.ArrayInt64:
+		//JSON API spec inconsistency #4: arrays are returned as a string holding the JSON-encoded array
+		decoder := json.NewDecoder(strings.NewReader(fieldValueString))
+		decoder.UseNumber()
+		var array []any
+		err := decoder.Decode(&array)
 		if err != nil {
-			log.DefaultLogger.Error(fmt.Sprintf("Cannot convert field value to type double: %s", fieldValueString))
-			panic(err)
+			return nil, newDecodeError(DecodeErrorTypeMismatch, fieldName, "cannot convert field value to type %s: %s", schemaType, fieldValueString)
 		}
-	case field.Int:
-		fieldValue, err = strconv.ParseInt(fieldValueString, 10, 64)
+
+		return parseArray(fieldName, array, schemaType)
+	case field.Blob:
+		blob, err := base64.StdEncoding.DecodeString(fieldValueString)
 		if err != nil {
-			log.DefaultLogger.Error(fmt.Sprintf("Cannot convert field value to type int: %s", fieldValueString))
-			panic(err)
+			return nil, newDecodeError(DecodeErrorTypeMismatch, fieldName, "cannot convert field value to type blob: %s", fieldValueString)
 		}
-	case field.String:
-		fieldValue = fieldValueString
+
+		return field.NewBlobValue(blob, blobTypeHint), nil
+	case field.String, field.RString, field.Unknown:
+		return fieldValueString, nil
 	case field.Timestamp:
 		fieldValueInt, err := strconv.ParseInt(fieldValueString, 10, 64)
 		if err != nil {
-			log.DefaultLogger.Error(fmt.Sprintf("Cannot convert field value to type timestamp: %s", fieldValueString))
-			panic(err)
+			return nil, newDecodeError(DecodeErrorTypeMismatch, fieldName, "cannot convert field value to type timestamp: %s", fieldValueString)
 		}
 
-		fieldValue = time.UnixMicro(fieldValueInt)
+		return time.UnixMicro(fieldValueInt), nil
 	case field.Date:
 		fieldValueInt, err := strconv.ParseInt(fieldValueString, 10, 64)
 		if err != nil {
-			log.DefaultLogger.Error(fmt.Sprintf("Cannot convert field value to type date: %s", fieldValueString))
-			panic(err)
+			return nil, newDecodeError(DecodeErrorTypeMismatch, fieldName, "cannot convert field value to type date: %s", fieldValueString)
 		}
 
-		fieldValue = time.Unix(fieldValueInt, 0)
+		return time.Unix(fieldValueInt, 0), nil
 	default:
-		err := fmt.Errorf("unsupported field type %d", schemaType)
-		log.DefaultLogger.Error(err.Error())
-		panic(err)
+		return nil, newDecodeError(DecodeErrorUnknownType, fieldName, "unsupported schema field type %v", schemaType)
 	}
-
-	return fieldValue
 }
 
-func (espWsClient *EspWsClient) validateField(name string, value any, sub *subscription, fieldType field.SchemaType) error {
-	//JSON API spec inconsistency #2: unlike CBOR structure, all field values are returned as a string regardless of schema type
-	if sub.format == jsonFormat {
-		return espWsClient.validateFieldJson(name, value)
-	}
+// parseArray converts the elements of an array to the element type of the schema type. Null elements, and NaN
+// elements of double arrays, are kept as nil.
+func parseArray(fieldName string, rawArray []any, schemaType field.SchemaType) (any, *DecodeError) {
+	switch schemaType {
+	case field.ArrayDouble:
+		array := make([]*float64, len(rawArray))
+		for i, element := range rawArray {
+			if element == nil {
+				continue
+			}
 
-	switch fieldType {
-	case field.Array:
-		switch value.(type) {
-		case []any:
-			return nil
-		}
-	case field.Blob:
-		switch value.(type) {
-		case []byte:
-			return nil
-		}
-	case field.Double:
-		switch value.(type) {
-		case float32, float64:
-			return nil
-		}
-	case field.Int:
-		switch value.(type) {
-		case int, uint, int8, int16, int32, int64, uint8, uint16, uint32, uint64:
-			return nil
-		}
-	case field.String:
-		switch value.(type) {
-		case string:
-			return nil
+			value, ok := toFloat64(element)
+			if !ok {
+				return nil, newDecodeError(DecodeErrorTypeMismatch, fieldName, "unexpected element type %T at index %d", element, i)
+			}
+			if !math.IsNaN(value) {
+				array[i] = &value
+			}
 		}
-	case field.Timestamp:
-		switch value.(type) {
-		case uint64:
-			return nil
+
+		return array, nil
+	case field.ArrayInt32:
+		array := make([]*int32, len(rawArray))
+		for i, element := range rawArray {
+			if element == nil {
+				continue
+			}
+
+			value, ok := toInt64(element)
+			if !ok || value < math.MinInt32 || value > math.MaxInt32 {
+				return nil, newDecodeError(DecodeErrorTypeMismatch, fieldName, "unexpected element %v at index %d", element, i)
+			}
+			int32Value := int32(value)
+			array[i] = &int32Value
 		}
-	case field.Date:
-		switch value.(type) {
-		case uint64:
-			return nil
+
+		return array, nil
+	case field.ArrayInt64:
+		array := make([]*int64, len(rawArray))
+		for i, element := range rawArray {
+			if element == nil {
+				continue
+			}
+
+			value, ok := toInt64(element)
+			if !ok {
+				return nil, newDecodeError(DecodeErrorTypeMismatch, fieldName, "unexpected element %v at index %d", element, i)
+			}
+			array[i] = &value
 		}
+
+		return array, nil
 	default:
-		err := fmt.Errorf("unexpected schema field type %v", fieldType)
-		log.DefaultLogger.Error(err.Error())
-		panic(err)
+		return nil, newDecodeError(DecodeErrorUnknownType, fieldName, "%v is not an array type", schemaType)
 	}
+}
 
-	return fmt.Errorf("unexpected value type %T for field %s", value, name)
+func parseMoney(fieldName string, value string) (any, *DecodeError) {
+	fieldValue, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil, newDecodeError(DecodeErrorTypeMismatch, fieldName, "cannot convert field value to type money: %s", value)
+	}
+
+	return fieldValue, nil
 }
 
-func (espWsClient *EspWsClient) validateFieldJson(name string, value any) error {
-	switch value.(type) {
-	//JSON API spec inconsistency #3: unlike CBOR, blob values are contained within a string map. The map has two keys:
-	// - @type, providing the file signature (which is unnecessary since it's already contained and can be inferred from the body)
-	// - value, holding a base64-encoded string of the actual blob data
-	case map[string]any:
-		actualValue := value.(map[string]any)["*value"]
-		if actualValue == nil {
-			return fmt.Errorf("blob value for field %s is nil", name)
-		}
+// toInt64 converts integers of any type, including JSON numbers, to int64.
+func toInt64(value any) (int64, bool) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), true
+	case int8:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint:
+		return int64(v), uint64(v) <= math.MaxInt64
+	case uint8:
+		return int64(v), true
+	case uint16:
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	case uint64:
+		return int64(v), v <= math.MaxInt64
+	case json.Number:
+		i, err := v.Int64()
+		return i, err == nil
+	default:
+		return 0, false
+	}
+}
 
-		switch actualValue.(type) {
-		case string:
-			return nil
-		}
+// toFloat64 converts numbers of any type, including JSON numbers, to float64.
+func toFloat64(value any) (float64, bool) {
+	switch v := value.(type) {
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	default:
+		i, ok := toInt64(value)
+		return float64(i), ok
+	}
+}
+
+// stringifyValue represents a value of a field of unknown type as a string.
+func stringifyValue(value any) string {
+	switch v := value.(type) {
 	case string:
-		return nil
+		return v
+	case []byte:
+		return base64.StdEncoding.EncodeToString(v)
+	case map[string]any, map[any]any, []any:
+		valueBytes, err := json.Marshal(v)
+		if err == nil {
+			return string(valueBytes)
+		}
 	}
 
-	return fmt.Errorf("unexpected value type %T for JSON field %s", value, name)
+	return fmt.Sprint(value)
+}
+
+func newTypeMismatchError(fieldName string, value any, schemaType field.SchemaType) *DecodeError {
+	return newDecodeError(DecodeErrorTypeMismatch, fieldName, "unexpected value type %T for schema type %v", value, schemaType)
 }
 
 func (espWsClient *EspWsClient) handleProjectLoadedMessage(message *messagedto.ProjectLoadedMessageDTO) {
 	log.DefaultLogger.Debug(fmt.Sprintf("Received 'project-loaded' message: %v", message))
 
-	if espWsClient.OnProjectLoaded != nil {
-		espWsClient.OnProjectLoaded(message.Name)
-	}
+	// Subscriptions are dropped by the server when a project is removed, so they are re-established on reload.
+	espWsClient.resubscribe(&message.Name)
+
+	espWsClient.emit(ProjectLoaded{ProjectName: message.Name})
 }
 
 func (espWsClient *EspWsClient) handleProjectRemovedMessage(message *messagedto.ProjectRemovedMessageDTO) {
 	log.DefaultLogger.Debug(fmt.Sprintf("Received 'project-removed' message: %v", message))
 
-	if espWsClient.OnProjectRemoved != nil {
-		espWsClient.OnProjectRemoved(message.Name)
-	}
-}
-
-func (espWsClient *EspWsClient) getSchemaFieldType(sub *subscription, fieldName string) (*field.SchemaType, error) {
-	if sub.schema == nil {
-		return nil, fmt.Errorf("no schema received for field: %s", fieldName)
-	}
-
-	fieldType, fieldExists := sub.schema[fieldName]
-	if !fieldExists {
-		return nil, fmt.Errorf("no schema type found for field: %s", fieldName)
-	}
-
-	return &fieldType, nil
+	espWsClient.emit(ProjectRemoved{ProjectName: message.Name})
 }
 
 func (espWsClient *EspWsClient) handleHandshakeSuccessful() {
 	espWsClient.isConnected = true
+	espWsClient.reconnectAttempt = 0
 
-	if espWsClient.OnConnected != nil {
-		espWsClient.OnConnected()
-	}
-}
-
-func (espWsClient *EspWsClient) handleConnectionClosed() {
-	espWsClient.isConnected = false
-}
+	espWsClient.resubscribe(nil)
 
-func (espWsClient *EspWsClient) handleConnectionError() {
-	espWsClient.Errors <- fmt.Errorf("websocket connection error")
+	espWsClient.emit(ConnectionStateChanged{State: ConnectionStateConnected})
 }
 
 func decodeBulkMessageString(message string) (*[]byte, error) {
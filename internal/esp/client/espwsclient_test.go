@@ -0,0 +1,764 @@
+/*
+	Copyright © 2023, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+	SPDX-License-Identifier: Apache-2.0
+*/
+
+package client
+
+import (
+	"context"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"grafana-esp-plugin/internal/esp/client/messagedto"
+	"grafana-esp-plugin/internal/esp/fakeserver"
+	"grafana-esp-plugin/internal/esp/field"
+	"grafana-esp-plugin/internal/esp/windowevent"
+	"grafana-esp-plugin/internal/esp/windowstate"
+)
+
+const testTimeout = 5 * time.Second
+
+var testSchema = []fakeserver.SchemaField{
+	{Name: "id", Type: "int64", Key: true},
+	{Name: "value", Type: "double"},
+}
+
+// newTestClient returns a client connected in-memory to a fake ESP server.
+func newTestClient(t *testing.T) (*fakeserver.Server, *EspWsClient) {
+	s := fakeserver.New()
+	c := New(url.URL{Scheme: "ws", Host: "esp", Path: "/connect"}, nil)
+	c.Transport = s.Transport()
+	c.Backoff = Backoff{InitialDelay: 10 * time.Millisecond, MaxDelay: 10 * time.Millisecond, Multiplier: 1}
+	c.Connect(context.Background())
+	t.Cleanup(c.Close)
+
+	return s, c
+}
+
+func testEntry(id uint64) map[string]any {
+	return map[string]any{
+		"@timestamp": uint64(time.Now().UnixMicro()),
+		"@opcode":    "insert",
+		"id":         id,
+		"value":      float64(id) / 2,
+	}
+}
+
+func testContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	t.Cleanup(cancel)
+
+	return ctx
+}
+
+func nextRequest(t *testing.T, s *fakeserver.Server) messagedto.StreamMessageDTO {
+	request, err := s.NextRequest(testContext(t))
+	if err != nil {
+		t.Fatalf("timed out waiting for event-stream request")
+	}
+
+	return request
+}
+
+// sendTestEvents waits for the subscription to reach the server and sends the test schema and the given events.
+func sendTestEvents(t *testing.T, s *fakeserver.Server, subscriptionId string, ids ...uint64) {
+	err := s.WaitForSubscription(testContext(t), subscriptionId)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+
+	err = s.SendSchema(subscriptionId, testSchema)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+
+	entries := make([]map[string]any, 0, len(ids))
+	for _, id := range ids {
+		entries = append(entries, testEntry(id))
+	}
+
+	err = s.SendEvents(subscriptionId, entries)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func waitForSubscriptionEvent[E Event](t *testing.T, sub *Subscription) E {
+	timeout := time.After(testTimeout)
+	for {
+		select {
+		case event := <-sub.Events():
+			if e, ok := event.(E); ok {
+				return e
+			}
+		case <-timeout:
+			var e E
+			t.Errorf("timed out waiting for %T", e)
+			return e
+		}
+	}
+}
+
+func waitForWindowEvents(t *testing.T, sub *Subscription) []windowevent.WindowEvent {
+	return waitForSubscriptionEvent[WindowEventsReceived](t, sub).WindowEvents
+}
+
+// waitForWindowEvent returns the first window event of the next batch of window events.
+func waitForWindowEvent(t *testing.T, sub *Subscription) windowevent.WindowEvent {
+	windowEvents := waitForWindowEvents(t, sub)
+	if len(windowEvents) == 0 {
+		return windowevent.WindowEvent{}
+	}
+
+	return windowEvents[0]
+}
+
+func waitForClientEvent[E Event](t *testing.T, c *EspWsClient) E {
+	timeout := time.After(testTimeout)
+	for {
+		select {
+		case event := <-c.Events():
+			if e, ok := event.(E); ok {
+				return e
+			}
+		case <-timeout:
+			var e E
+			t.Fatalf("timed out waiting for %T", e)
+			return e
+		}
+	}
+}
+
+func waitForConnectionState(t *testing.T, c *EspWsClient, state ConnectionState) ConnectionStateChanged {
+	timeout := time.After(testTimeout)
+	for {
+		select {
+		case event := <-c.Events():
+			if e, ok := event.(ConnectionStateChanged); ok && e.State == state {
+				return e
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for connection state %v", state)
+			return ConnectionStateChanged{}
+		}
+	}
+}
+
+// drainEvents discards connection-wide events until the client is stopped.
+func drainEvents(c *EspWsClient) {
+	go func() {
+		for range c.Events() {
+		}
+	}()
+}
+
+func TestSubscribeReceivesEvents(t *testing.T) {
+	s, c := newTestClient(t)
+	drainEvents(c)
+
+	sub, err := c.Subscribe("project", "cq", "window", 1, 2, nil, CborFormat, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	request := nextRequest(t, s)
+	if request.Action != "set" || request.Id != sub.Id() || request.Window != "project/cq/window" {
+		t.Errorf("unexpected event-stream request: %v", request)
+	}
+
+	sendTestEvents(t, s, sub.Id(), 1)
+
+	schema := waitForSubscriptionEvent[SchemaReceived](t, sub)
+	if len(schema.Schema.Fields) != 2 || schema.Schema.Fields[0].Type != field.Int64 {
+		t.Errorf("unexpected schema: %v", schema.Schema.Fields)
+	}
+	keyFields := schema.Schema.KeyFields()
+	if len(keyFields) != 1 || keyFields[0].Name != "id" {
+		t.Errorf("expected key field id, got %v", keyFields)
+	}
+
+	event := waitForWindowEvent(t, sub)
+	if event.Opcode != "insert" || len(event.Fields) != 2 {
+		t.Errorf("unexpected window event: %v", event)
+	}
+	eventKeyFields := event.KeyFields()
+	if len(eventKeyFields) != 1 || eventKeyFields[0].Name != "id" || eventKeyFields[0].Value != int64(1) {
+		t.Errorf("expected key field id, got %v", eventKeyFields)
+	}
+}
+
+func TestEventFieldsFollowSchema(t *testing.T) {
+	s, c := newTestClient(t)
+	drainEvents(c)
+
+	schema := []fakeserver.SchemaField{
+		{Name: "value", Type: "double"},
+		{Name: "name", Type: "string"},
+		{Name: "id", Type: "int64", Key: true},
+		{Name: "count", Type: "int32"},
+	}
+
+	sub, err := c.Subscribe("project", "cq", "window", 0, 0, []string{"id", "value", "name"}, CborFormat, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	err = s.WaitForSubscription(testContext(t), sub.Id())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	err = s.SendSchema(sub.Id(), schema)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	received := waitForSubscriptionEvent[SchemaReceived](t, sub)
+	if len(received.Schema.Fields) != 3 {
+		t.Errorf("expected %v included fields, got %v", 3, received.Schema.Fields)
+	}
+
+	// Absent fields are left out, while null fields are kept.
+	err = s.SendEvents(sub.Id(), []map[string]any{
+		{"@timestamp": uint64(0), "@opcode": "insert", "id": uint64(1), "value": 0.5},
+		{"@timestamp": uint64(0), "@opcode": "insert", "id": uint64(2), "value": 0.5, "name": nil},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	windowEvents := waitForWindowEvents(t, sub)
+	if len(windowEvents) != 2 {
+		t.Fatalf("expected %v events, got %v", 2, windowEvents)
+	}
+	for i, expectedFields := range [][]field.Field{
+		{field.New("value", 0.5), field.New("id", int64(1))},
+		{field.New("value", 0.5), field.New("name", (*string)(nil)), field.New("id", int64(2))},
+	} {
+		event := windowEvents[i]
+		if len(event.Fields) != len(expectedFields) {
+			t.Fatalf("expected %v, got %v", expectedFields, event.Fields)
+		}
+		for j, expected := range expectedFields {
+			if expected.Name != event.Fields[j].Name || expected.Value != event.Fields[j].Value {
+				t.Errorf("expected %v, got %v", expected, event.Fields[j])
+			}
+		}
+	}
+}
+
+func TestKeyFieldsAreKept(t *testing.T) {
+	s, c := newTestClient(t)
+	drainEvents(c)
+
+	schema := []fakeserver.SchemaField{
+		{Name: "value", Type: "double"},
+		{Name: "name", Type: "string"},
+		{Name: "id", Type: "int64", Key: true},
+	}
+
+	sub, err := c.Subscribe("project", "cq", "window", 0, 0, []string{"value"}, CborFormat, true)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// All fields are requested, as the key fields are not known before the schema has been received.
+	request := nextRequest(t, s)
+	if len(request.IncludeFields) != 0 {
+		t.Errorf("expected all fields to be requested, got %v", request.IncludeFields)
+	}
+
+	err = s.SendSchema(sub.Id(), schema)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	received := waitForSubscriptionEvent[SchemaReceived](t, sub)
+	keyFields := received.Schema.KeyFields()
+	if len(received.Schema.Fields) != 2 || len(keyFields) != 1 || keyFields[0].Name != "id" {
+		t.Errorf("expected fields %v and key field %v, got %v", []string{"value", "id"}, "id", received.Schema.Fields)
+	}
+
+	err = s.SendEvents(sub.Id(), []map[string]any{
+		{"@timestamp": uint64(0), "@opcode": "insert", "id": uint64(1), "value": 0.5, "name": "a"},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	windowEvents := waitForWindowEvents(t, sub)
+	if len(windowEvents) != 1 {
+		t.Fatalf("expected %v events, got %v", 1, windowEvents)
+	}
+	expectedFields := []field.Field{field.New("value", 0.5), field.New("id", int64(1))}
+	if len(windowEvents[0].Fields) != len(expectedFields) {
+		t.Fatalf("expected %v, got %v", expectedFields, windowEvents[0].Fields)
+	}
+	for i, expected := range expectedFields {
+		if expected.Name != windowEvents[0].Fields[i].Name || expected.Value != windowEvents[0].Fields[i].Value {
+			t.Errorf("expected %v, got %v", expected, windowEvents[0].Fields[i])
+		}
+	}
+}
+
+func TestPartialUpdatesKeepWindowStateFields(t *testing.T) {
+	s, c := newTestClient(t)
+	drainEvents(c)
+
+	sub, err := c.Subscribe("project", "cq", "window", 0, 0, []string{"id", "value", "name"}, CborFormat, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	err = s.WaitForSubscription(testContext(t), sub.Id())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	err = s.SendSchema(sub.Id(), []fakeserver.SchemaField{
+		{Name: "id", Type: "int64", Key: true},
+		{Name: "value", Type: "double"},
+		{Name: "name", Type: "string"},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	waitForSubscriptionEvent[SchemaReceived](t, sub)
+
+	err = s.SendEvents(sub.Id(), []map[string]any{
+		{"@timestamp": uint64(0), "@opcode": "insert", "id": uint64(1), "value": 0.5, "name": "a"},
+		{"@timestamp": uint64(1), "@opcode": "update", "id": uint64(1), "value": 1.5},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	state := windowstate.New(0)
+	for _, windowEvent := range waitForWindowEvents(t, sub) {
+		state.Apply(windowEvent)
+	}
+
+	rows := state.Rows()
+	if len(rows) != 1 {
+		t.Fatalf("expected %v rows, got %v", 1, rows)
+	}
+	values := make(map[string]any)
+	for _, f := range rows[0].Fields {
+		values[f.Name] = f.Value
+	}
+	if values["value"] != 1.5 {
+		t.Errorf("expected %v, got %v", 1.5, values["value"])
+	}
+	if name, ok := values["name"].(string); !ok || name != "a" {
+		t.Errorf("expected %v, got %v", "a", values["name"])
+	}
+}
+
+func TestBulkMessagesAreUnwrapped(t *testing.T) {
+	s, c := newTestClient(t)
+	drainEvents(c)
+
+	sub, err := c.Subscribe("project", "cq", "window", 0, 0, nil, CborFormat, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	sendTestEvents(t, s, sub.Id())
+	waitForSubscriptionEvent[SchemaReceived](t, sub)
+
+	err = s.SendBulk(sub.Id(), map[string]any{"error": map[string]any{"@id": sub.Id(), "text": "bulk error"}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	received := waitForSubscriptionEvent[ErrorReceived](t, sub)
+	if received.Err == nil || received.Err.Error() != "bulk error" {
+		t.Errorf("expected %v, got %v", "bulk error", received.Err)
+	}
+}
+
+func TestEventMessagesAreBatched(t *testing.T) {
+	s, c := newTestClient(t)
+	drainEvents(c)
+
+	sub, err := c.Subscribe("project", "cq", "window", 0, 0, nil, CborFormat, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	sendTestEvents(t, s, sub.Id(), 1, 2, 3)
+
+	windowEvents := waitForWindowEvents(t, sub)
+	if len(windowEvents) != 3 {
+		t.Fatalf("expected %v events, got %v", 3, len(windowEvents))
+	}
+	for i, windowEvent := range windowEvents {
+		if windowEvent.Fields[0].Value != int64(i+1) {
+			t.Errorf("expected %v, got %v", int64(i+1), windowEvent.Fields[0].Value)
+		}
+	}
+}
+
+func TestBulkEventMessagesAreBatched(t *testing.T) {
+	s, c := newTestClient(t)
+	drainEvents(c)
+
+	sub, err := c.Subscribe("project", "cq", "window", 0, 0, nil, JsonFormat, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	sendTestEvents(t, s, sub.Id())
+	waitForSubscriptionEvent[SchemaReceived](t, sub)
+
+	eventsMessage := func(ids ...string) map[string]any {
+		entries := make([]any, 0, len(ids))
+		for _, id := range ids {
+			entries = append(entries, map[string]any{
+				"event": map[string]any{"@timestamp": "0", "@opcode": "insert", "id": id, "value": "0.5"},
+			})
+		}
+
+		return map[string]any{"events": map[string]any{"@id": sub.Id(), "entries": entries}}
+	}
+	err = s.SendBulk(sub.Id(), eventsMessage("1", "2"), eventsMessage("3"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	windowEvents := waitForWindowEvents(t, sub)
+	if len(windowEvents) != 3 {
+		t.Fatalf("expected %v events, got %v", 3, len(windowEvents))
+	}
+	if windowEvents[2].Fields[0].Value != int64(3) {
+		t.Errorf("expected %v, got %v", int64(3), windowEvents[2].Fields[0].Value)
+	}
+}
+
+func TestErrorsAreRoutedToSubscriptions(t *testing.T) {
+	s, c := newTestClient(t)
+
+	sub, err := c.Subscribe("project", "cq", "window", 0, 0, nil, CborFormat, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	err = s.WaitForSubscription(testContext(t), sub.Id())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	err = s.SendError(sub.Id(), "subscription error")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	subscriptionError := waitForSubscriptionEvent[ErrorReceived](t, sub)
+	if subscriptionError.SubscriptionId != sub.Id() {
+		t.Errorf("expected %v, got %v", sub.Id(), subscriptionError.SubscriptionId)
+	}
+
+	// Errors without a known subscription id are only logged.
+	for _, id := range []string{"", "project/cq/window/unknown"} {
+		err = s.SendError(id, "unrouted error")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	err = s.SendProjectLoaded("project")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	timeout := time.After(testTimeout)
+	for projectLoaded := false; !projectLoaded; {
+		select {
+		case event := <-c.Events():
+			if _, ok := event.(ErrorReceived); ok {
+				t.Errorf("unexpected connection error: %v", event)
+			}
+			_, projectLoaded = event.(ProjectLoaded)
+		case event := <-sub.Events():
+			t.Errorf("unexpected subscription event: %v", event)
+		case <-timeout:
+			t.Fatalf("timed out waiting for %T", ProjectLoaded{})
+		}
+	}
+}
+
+func TestProjectLifecycleEvents(t *testing.T) {
+	s, c := newTestClient(t)
+
+	sub, err := c.Subscribe("project", "cq", "window", 0, 0, nil, CborFormat, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	nextRequest(t, s)
+	waitForConnectionState(t, c, ConnectionStateConnected)
+
+	err = s.SendProjectRemoved("project")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	removed := waitForClientEvent[ProjectRemoved](t, c)
+	if removed.ProjectName != "project" {
+		t.Errorf("expected %v, got %v", "project", removed.ProjectName)
+	}
+
+	err = s.SendProjectLoaded("project")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	loaded := waitForClientEvent[ProjectLoaded](t, c)
+	if loaded.ProjectName != "project" {
+		t.Errorf("expected %v, got %v", "project", loaded.ProjectName)
+	}
+
+	// Subscriptions to a reloaded project are sent again.
+	request := nextRequest(t, s)
+	if request.Action != "set" || request.Id != sub.Id() {
+		t.Errorf("expected resent subscription %s, got %v", sub.Id(), request)
+	}
+	waitForSubscriptionEvent[Resubscribed](t, sub)
+
+	err = s.SendInfoDiscard(3, 10)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	discarded := waitForClientEvent[EventsDiscarded](t, c)
+	if discarded.Discarded != 3 || discarded.Total != 10 {
+		t.Errorf("unexpected discard info: %v", discarded)
+	}
+}
+
+func TestReconnectReplaysSubscriptions(t *testing.T) {
+	s, c := newTestClient(t)
+
+	sub, err := c.Subscribe("project", "cq", "window", 0, 0, nil, CborFormat, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	nextRequest(t, s)
+	waitForConnectionState(t, c, ConnectionStateConnected)
+
+	s.DropConnections()
+
+	waitForConnectionState(t, c, ConnectionStateDisconnected)
+	reconnecting := waitForConnectionState(t, c, ConnectionStateReconnecting)
+	if reconnecting.ReconnectAttempt != 1 {
+		t.Errorf("expected %v, got %v", 1, reconnecting.ReconnectAttempt)
+	}
+	waitForConnectionState(t, c, ConnectionStateConnected)
+
+	request := nextRequest(t, s)
+	if request.Action != "set" || request.Id != sub.Id() {
+		t.Errorf("expected replayed subscription %s, got %v", sub.Id(), request)
+	}
+
+	resubscribed := waitForSubscriptionEvent[Resubscribed](t, sub)
+	if resubscribed.SubscriptionId != sub.Id() {
+		t.Errorf("expected %v, got %v", sub.Id(), resubscribed.SubscriptionId)
+	}
+}
+
+func TestWebsocketTransport(t *testing.T) {
+	s := fakeserver.New()
+	httpServer := httptest.NewServer(s.Handler())
+	t.Cleanup(httpServer.Close)
+
+	u, err := url.Parse(strings.Replace(httpServer.URL, "http://", "ws://", 1) + "/connect")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	c := New(*u, nil)
+	c.Backoff = Backoff{InitialDelay: 10 * time.Millisecond, MaxDelay: 10 * time.Millisecond, Multiplier: 1}
+	c.Connect(context.Background())
+	t.Cleanup(c.Close)
+
+	sub, err := c.Subscribe("project", "cq", "window", 0, 0, nil, CborFormat, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	waitForConnectionState(t, c, ConnectionStateConnected)
+	drainEvents(c)
+
+	sendTestEvents(t, s, sub.Id(), 1, 2)
+	windowEvents := waitForWindowEvents(t, sub)
+	if len(windowEvents) != 2 {
+		t.Fatalf("expected %v events, got %v", 2, len(windowEvents))
+	}
+	for i, expectedId := range []uint64{1, 2} {
+		event := windowEvents[i]
+		if len(event.Fields) != 2 || event.Fields[0].Value != int64(expectedId) {
+			t.Errorf("expected id %v, got %v", expectedId, event.Fields)
+		}
+	}
+
+	s.DropConnections()
+	nextRequest(t, s)
+	request := nextRequest(t, s)
+	if request.Action != "set" || request.Id != sub.Id() {
+		t.Errorf("expected replayed subscription %s, got %v", sub.Id(), request)
+	}
+}
+
+func TestConcurrentSubscribeReceiveClose(t *testing.T) {
+	s, c := newTestClient(t)
+	drainEvents(c)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			sub, err := c.Subscribe("project", "cq", "window", 0, 0, nil, CborFormat, false)
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+				return
+			}
+
+			sendTestEvents(t, s, sub.Id(), 1, 2, 3)
+			waitForWindowEvent(t, sub)
+
+			err = sub.Update(1, 1, nil)
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+
+			err = sub.Cancel()
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	closed := make(chan struct{})
+	go func() {
+		c.Close()
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+	case <-time.After(testTimeout):
+		t.Fatalf("timed out waiting for client to close")
+	}
+
+	_, err := c.Subscribe("project", "cq", "window", 0, 0, nil, CborFormat, false)
+	if err != ErrClientNotRunning {
+		t.Errorf("expected %v, got %v", ErrClientNotRunning, err)
+	}
+}
+
+func TestJsonFormatMatchesCbor(t *testing.T) {
+	s, c := newTestClient(t)
+	drainEvents(c)
+
+	schema := []fakeserver.SchemaField{
+		{Name: "id", Type: "int64", Key: true},
+		{Name: "delta", Type: "int32"},
+		{Name: "value", Type: "double"},
+		{Name: "price", Type: "money"},
+		{Name: "name", Type: "string"},
+		{Name: "updated", Type: "stamp"},
+		{Name: "day", Type: "date"},
+		{Name: "image", Type: "blob"},
+		{Name: "values", Type: "array(dbl)"},
+		{Name: "counts", Type: "array(i32)"},
+		{Name: "totals", Type: "array(i64)"},
+		{Name: "label", Type: "rstring"},
+		{Name: "shape", Type: "geometry"},
+	}
+	entry := map[string]any{
+		"@timestamp": uint64(1700000000000000),
+		"@opcode":    "upsert",
+		"id":         uint64(7),
+		"delta":      int64(-3),
+		"value":      0.25,
+		"price":      12.5,
+		"name":       "seven",
+		"updated":    uint64(1700000000123456),
+		"day":        uint64(1700000000),
+		"image":      []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1a, '\n'},
+		"values":     []any{1.5, 2.0, nil, -0.5},
+		"counts":     []any{uint64(1), int64(-2), nil},
+		"totals":     []any{uint64(1) << 40},
+		"label":      "seventh",
+		"shape":      "POINT (1 2)",
+	}
+
+	events := make(map[string]windowevent.WindowEvent)
+	for _, format := range []string{CborFormat, JsonFormat} {
+		sub, err := c.Subscribe("project", "cq", "window", 0, 0, nil, format, false)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		request := nextRequest(t, s)
+		if request.Format != format {
+			t.Errorf("expected %v, got %v", format, request.Format)
+		}
+
+		err = s.SendSchema(sub.Id(), schema)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		err = s.SendEvents(sub.Id(), []map[string]any{entry})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		events[format] = waitForWindowEvent(t, sub)
+	}
+
+	cborEvent := events[CborFormat]
+	jsonEvent := events[JsonFormat]
+	if !cborEvent.Time.Equal(jsonEvent.Time) || cborEvent.Opcode != jsonEvent.Opcode {
+		t.Errorf("expected %v, got %v", cborEvent, jsonEvent)
+	}
+
+	if len(cborEvent.Fields) != len(schema) || len(jsonEvent.Fields) != len(schema) {
+		t.Fatalf("expected %d fields, got %v and %v", len(schema), cborEvent.Fields, jsonEvent.Fields)
+	}
+
+	expectedTypes := map[string]any{
+		"id":      int64(0),
+		"delta":   int32(0),
+		"value":   float64(0),
+		"price":   float64(0),
+		"name":    "",
+		"updated": time.Time{},
+		"day":     time.Time{},
+		"image":   field.BlobValue{},
+		"values":  []*float64{},
+		"counts":  []*int32{},
+		"totals":  []*int64{},
+		"label":   "",
+		"shape":   "",
+	}
+	for _, f := range cborEvent.Fields {
+		if reflect.TypeOf(f.Value) != reflect.TypeOf(expectedTypes[f.Name]) {
+			t.Errorf("field %s: expected %T, got %T", f.Name, expectedTypes[f.Name], f.Value)
+		}
+	}
+
+	for i, cborField := range cborEvent.Fields {
+		jsonField := jsonEvent.Fields[i]
+		if cborField.Name != jsonField.Name || !reflect.DeepEqual(cborField.Value, jsonField.Value) {
+			t.Errorf("expected %v (%T), got %v (%T)", cborField, cborField.Value, jsonField, jsonField.Value)
+		}
+	}
+}
+
+func TestSubscribeRejectsUnknownFormat(t *testing.T) {
+	_, c := newTestClient(t)
+
+	_, err := c.Subscribe("project", "cq", "window", 0, 0, nil, "xml", false)
+	if err == nil {
+		t.Errorf("expected non-nil error")
+	}
+}
@@ -0,0 +1,97 @@
+/*
+	Copyright © 2023, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+	SPDX-License-Identifier: Apache-2.0
+*/
+
+package client
+
+import (
+	"time"
+
+	"grafana-esp-plugin/internal/esp/field"
+	"grafana-esp-plugin/internal/esp/windowevent"
+)
+
+// Event is a notification emitted by EspWsClient. Connection-wide events are received from EspWsClient.Events,
+// events concerning a single subscription from Subscription.Events.
+type Event interface {
+	isEvent()
+}
+
+type ConnectionState int
+
+const (
+	ConnectionStateDisconnected ConnectionState = iota
+	ConnectionStateConnected
+	ConnectionStateReconnecting
+)
+
+func (state ConnectionState) String() string {
+	switch state {
+	case ConnectionStateDisconnected:
+		return "disconnected"
+	case ConnectionStateConnected:
+		return "connected"
+	case ConnectionStateReconnecting:
+		return "reconnecting"
+	default:
+		return "unknown"
+	}
+}
+
+// ConnectionStateChanged is emitted when the connection is lost, when a reconnection is scheduled, and when the
+// handshake with the server succeeds. ReconnectAttempt and ReconnectDelay are only set for
+// ConnectionStateReconnecting.
+type ConnectionStateChanged struct {
+	State            ConnectionState
+	ReconnectAttempt int
+	ReconnectDelay   time.Duration
+}
+
+type SchemaReceived struct {
+	SubscriptionId string
+	Schema         *field.Schema
+}
+
+// WindowEventsReceived carries the window events of an events message, or of consecutive events messages of a bulk
+// message, in the order in which they were received.
+type WindowEventsReceived struct {
+	SubscriptionId string
+	WindowEvents   []windowevent.WindowEvent
+}
+
+// ErrorReceived carries an error message of the server concerning a subscription, and is emitted on the Events of
+// that subscription only.
+type ErrorReceived struct {
+	SubscriptionId string
+	Err            error
+}
+
+// Resubscribed is emitted on the Events of a subscription when it is re-established, after a reconnection or the
+// reload of its project. It precedes the schema and events of the re-established subscription, so that state derived
+// from the events received before can be dropped.
+type Resubscribed struct {
+	SubscriptionId string
+}
+
+type ProjectLoaded struct {
+	ProjectName string
+}
+
+type ProjectRemoved struct {
+	ProjectName string
+}
+
+type EventsDiscarded struct {
+	Discarded uint64
+	Total     uint64
+}
+
+func (ConnectionStateChanged) isEvent() {}
+func (SchemaReceived) isEvent()         {}
+func (WindowEventsReceived) isEvent()   {}
+func (ErrorReceived) isEvent()          {}
+func (Resubscribed) isEvent()           {}
+func (ProjectLoaded) isEvent()          {}
+func (ProjectRemoved) isEvent()         {}
+func (EventsDiscarded) isEvent()        {}
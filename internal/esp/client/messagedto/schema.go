@@ -9,9 +9,10 @@ type SchemaMessageDTO struct {
 	SubscriptionId string `json:"@id"`
 	WindowPath     string `json:"@window"`
 	Fields         []struct {
-		Key  string `json:"@key"`
-		Name string `json:"@name"`
-		Type string `json:"@type"`
+		Key       string `json:"@key"`
+		Name      string `json:"@name"`
+		Type      string `json:"@type"`
+		Precision string `json:"@precision,omitempty"`
 	} `json:"fields"`
 	SchemaString string `json:"schema-string"`
 }
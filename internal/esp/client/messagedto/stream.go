@@ -11,9 +11,9 @@ type StreamMessageDTO struct {
 	Pagesize      int      `json:"pagesize,omitempty"`
 	Action        string   `json:"action"`
 	Id            string   `json:"id"`
-	Window        string   `json:"window"`
-	Schema        bool     `json:"schema"`
-	UpdateDeletes bool     `json:"update-deletes"`
-	Format        string   `json:"format"`
-	IncludeFields []string `json:"include"`
+	Window        string   `json:"window,omitempty"`
+	Schema        bool     `json:"schema,omitempty"`
+	UpdateDeletes bool     `json:"update-deletes,omitempty"`
+	Format        string   `json:"format,omitempty"`
+	IncludeFields []string `json:"include,omitempty"`
 }
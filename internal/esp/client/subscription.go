@@ -0,0 +1,119 @@
+/*
+	Copyright © 2023, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+	SPDX-License-Identifier: Apache-2.0
+*/
+
+package client
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+// Subscription is a handle on an ESP event-stream subscription of an EspWsClient. Events are queued per
+// subscription, so that a subscription falling behind does not hold up the other subscriptions of the client.
+type Subscription struct {
+	client    *EspWsClient
+	id        string
+	events    chan Event
+	queue     []Event
+	queueLock sync.Mutex
+	queued    chan struct{}
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// Up to subscriptionEventQueueSize events are queued for a subscription, beyond which its oldest events are dropped.
+const (
+	subscriptionEventBufferSize = 64
+	subscriptionEventQueueSize  = 1024
+)
+
+func newSubscription(client *EspWsClient, id string) *Subscription {
+	s := &Subscription{
+		client: client,
+		id:     id,
+		events: make(chan Event, subscriptionEventBufferSize),
+		queued: make(chan struct{}, 1),
+		closed: make(chan struct{}),
+	}
+	go s.forward()
+
+	return s
+}
+
+func (s *Subscription) Id() string {
+	return s.id
+}
+
+// Events returns the channel of schema, window event and error events of the subscription. The channel is closed
+// when the subscription is cancelled or the client is stopped.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Update changes the delivery interval, maximum event count and included fields of the subscription without
+// affecting other subscriptions on the same connection.
+func (s *Subscription) Update(interval uint64, maxEvents uint64, fields []string) error {
+	return s.client.updateSubscription(s.id, interval, maxEvents, fields)
+}
+
+// Cancel deletes the subscription on the server. Cancelling an already cancelled subscription has no effect.
+func (s *Subscription) Cancel() error {
+	return s.client.cancelSubscription(s.id)
+}
+
+// enqueue queues an event for Events without blocking, dropping the oldest queued event if the queue is full.
+func (s *Subscription) enqueue(event Event) {
+	s.queueLock.Lock()
+	if len(s.queue) >= subscriptionEventQueueSize {
+		log.DefaultLogger.Warn("Dropped event of subscription falling behind", "subscriptionId", s.id, "event", fmt.Sprintf("%T", s.queue[0]))
+		s.queue = s.queue[1:]
+	}
+	s.queue = append(s.queue, event)
+	s.queueLock.Unlock()
+
+	select {
+	case s.queued <- struct{}{}:
+	default:
+	}
+}
+
+// close stops the delivery of events, upon which Events is closed. Events still queued are dropped.
+func (s *Subscription) close() {
+	s.closeOnce.Do(func() {
+		close(s.closed)
+	})
+}
+
+// forward emits the queued events of the subscription on Events until the subscription is closed.
+func (s *Subscription) forward() {
+	defer close(s.events)
+
+	for {
+		select {
+		case <-s.queued:
+		case <-s.closed:
+			return
+		}
+
+		for {
+			s.queueLock.Lock()
+			if len(s.queue) == 0 {
+				s.queueLock.Unlock()
+				break
+			}
+			event := s.queue[0]
+			s.queue = s.queue[1:]
+			s.queueLock.Unlock()
+
+			select {
+			case s.events <- event:
+			case <-s.closed:
+				return
+			}
+		}
+	}
+}
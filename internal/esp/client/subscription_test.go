@@ -0,0 +1,84 @@
+/*
+	Copyright © 2023, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+	SPDX-License-Identifier: Apache-2.0
+*/
+
+package client
+
+import (
+	"testing"
+)
+
+func TestSubscriptionUpdateAndCancel(t *testing.T) {
+	s, c := newTestClient(t)
+	drainEvents(c)
+
+	sub, err := c.Subscribe("project", "cq", "window", 1, 2, []string{"a"}, CborFormat, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	nextRequest(t, s)
+
+	err = sub.Update(3, 4, []string{"b"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	request := nextRequest(t, s)
+	if request.Action != "set" || request.Id != sub.Id() || request.Interval != 3 || request.MaxEvents != 4 || request.IncludeFields[0] != "b" {
+		t.Errorf("expected updated subscription request, got %v", request)
+	}
+
+	err = sub.Cancel()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	request = nextRequest(t, s)
+	if request.Action != "delete" || request.Id != sub.Id() || request.Window != "" {
+		t.Errorf("expected delete request, got %v", request)
+	}
+
+	// The events channel of a cancelled subscription is closed.
+	for range sub.Events() {
+	}
+
+	err = sub.Update(1, 2, nil)
+	if err == nil {
+		t.Errorf("expected non-nil error")
+	}
+
+	err = sub.Cancel()
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestSubscriptionFallingBehindDoesNotBlockOthers(t *testing.T) {
+	s, c := newTestClient(t)
+	drainEvents(c)
+
+	stalled, err := c.Subscribe("project", "cq", "window", 0, 0, nil, CborFormat, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	sub, err := c.Subscribe("project", "cq", "window", 0, 0, nil, CborFormat, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	messageCount := 2 * subscriptionEventBufferSize
+	for i := 0; i < messageCount; i++ {
+		sendTestEvents(t, s, stalled.Id(), uint64(i))
+	}
+	sendTestEvents(t, s, sub.Id(), 1)
+
+	event := waitForWindowEvent(t, sub)
+	if event.Fields[0].Value != int64(1) {
+		t.Errorf("expected %v, got %v", int64(1), event.Fields[0].Value)
+	}
+
+	for received := 0; received < messageCount; received++ {
+		waitForWindowEvents(t, stalled)
+	}
+}
@@ -0,0 +1,31 @@
+/*
+	Copyright © 2023, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+	SPDX-License-Identifier: Apache-2.0
+*/
+
+package transport
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// Transport opens connections to an ESP server.
+type Transport interface {
+	Dial(ctx context.Context, url url.URL, requestHeader http.Header) (Connection, error)
+}
+
+// Connection is a single, message-oriented connection to an ESP server. Read is called from one goroutine only,
+// while WriteText and Close may be called concurrently with Read.
+type Connection interface {
+	// Read blocks until the next message is received, and returns an error once the connection is closed.
+	Read() (Message, error)
+	WriteText(data []byte) error
+	Close() error
+}
+
+type Message struct {
+	Binary bool
+	Data   []byte
+}
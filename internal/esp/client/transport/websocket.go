@@ -0,0 +1,97 @@
+/*
+	Copyright © 2023, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+	SPDX-License-Identifier: Apache-2.0
+*/
+
+package transport
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// WebsocketTransport connects to ESP servers over websockets.
+type WebsocketTransport struct{}
+
+type websocketConnection struct {
+	conn      *websocket.Conn
+	writeLock sync.Mutex
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// websocketHandshakeTimeout bounds the opening handshake, in addition to the context passed to Dial.
+const websocketHandshakeTimeout = 30 * time.Second
+
+var ErrConnectionClosed = errors.New("connection closed")
+
+func (WebsocketTransport) Dial(ctx context.Context, url url.URL, requestHeader http.Header) (Connection, error) {
+	dialer := websocket.Dialer{
+		HandshakeTimeout: websocketHandshakeTimeout,
+		// ESP servers commonly use self-signed certificates, which are accepted.
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}
+
+	conn, resp, err := dialer.DialContext(ctx, url.String(), requestHeader)
+	if err != nil {
+		if resp != nil {
+			return nil, fmt.Errorf("%w: HTTP status %d", err, resp.StatusCode)
+		}
+		return nil, err
+	}
+
+	return &websocketConnection{
+		conn:   conn,
+		closed: make(chan struct{}),
+	}, nil
+}
+
+func (c *websocketConnection) Read() (Message, error) {
+	messageType, data, err := c.conn.ReadMessage()
+	if err != nil {
+		select {
+		case <-c.closed:
+			return Message{}, ErrConnectionClosed
+		default:
+			return Message{}, err
+		}
+	}
+
+	return Message{Binary: messageType == websocket.BinaryMessage, Data: data}, nil
+}
+
+func (c *websocketConnection) WriteText(data []byte) error {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	select {
+	case <-c.closed:
+		return ErrConnectionClosed
+	default:
+	}
+
+	return c.conn.WriteMessage(websocket.TextMessage, data)
+}
+
+func (c *websocketConnection) Close() error {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	err := ErrConnectionClosed
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		closeMessage := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+		_ = c.conn.WriteMessage(websocket.CloseMessage, closeMessage)
+		err = c.conn.Close()
+	})
+
+	return err
+}
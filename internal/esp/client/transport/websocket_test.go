@@ -0,0 +1,114 @@
+/*
+	Copyright © 2023, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+	SPDX-License-Identifier: Apache-2.0
+*/
+
+package transport
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func parseUrl(t *testing.T, urlString string) url.URL {
+	u, err := url.Parse(urlString)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	return *u
+}
+
+func TestDialHonorsContext(t *testing.T) {
+	// The listener accepts connections but never answers the opening handshake.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			t.Cleanup(func() { _ = conn.Close() })
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err = WebsocketTransport{}.Dial(ctx, parseUrl(t, "ws://"+listener.Addr().String()+"/connect"), http.Header{})
+	if err == nil {
+		t.Fatalf("expected error, got nil")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected Dial to return once the context is done, took %v", elapsed)
+	}
+}
+
+func TestWebsocketConnection(t *testing.T) {
+	upgrader := websocket.Upgrader{}
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer foo" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			_ = conn.WriteMessage(websocket.BinaryMessage, data)
+		}
+	}))
+	t.Cleanup(httpServer.Close)
+	serverUrl := parseUrl(t, strings.Replace(httpServer.URL, "http://", "ws://", 1)+"/connect")
+
+	_, err := WebsocketTransport{}.Dial(context.Background(), serverUrl, http.Header{})
+	if err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("expected HTTP status 401 error, got %v", err)
+	}
+
+	conn, err := WebsocketTransport{}.Dial(context.Background(), serverUrl, http.Header{"Authorization": []string{"Bearer foo"}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	err = conn.WriteText([]byte("message"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	message, err := conn.Read()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !message.Binary || string(message.Data) != "message" {
+		t.Errorf("expected %v, got %v", "message", message)
+	}
+
+	_ = conn.Close()
+	if _, err = conn.Read(); err != ErrConnectionClosed {
+		t.Errorf("expected %v, got %v", ErrConnectionClosed, err)
+	}
+	if err = conn.WriteText([]byte("message")); err != ErrConnectionClosed {
+		t.Errorf("expected %v, got %v", ErrConnectionClosed, err)
+	}
+}
@@ -0,0 +1,97 @@
+/*
+	Copyright © 2023, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+	SPDX-License-Identifier: Apache-2.0
+*/
+
+// Package eventhistory keeps the most recent events of an ESP subscription, so that they can be replayed.
+package eventhistory
+
+import (
+	"time"
+
+	"grafana-esp-plugin/internal/esp/windowevent"
+)
+
+// History is a ring buffer of the most recent window events. It holds at most maxEvents events, and events are
+// dropped once they were added longer than maxAge ago, unless maxAge is zero. The buffer grows as events are added,
+// up to maxEvents.
+type History struct {
+	maxEvents int
+	maxAge    time.Duration
+	entries   []entry
+	first     int
+	count     int
+}
+
+// initialSize is the number of events that the buffer of a history holds before it first grows.
+const initialSize = 64
+
+type entry struct {
+	added time.Time
+	event windowevent.WindowEvent
+}
+
+func New(maxEvents int, maxAge time.Duration) *History {
+	return &History{
+		maxEvents: maxEvents,
+		maxAge:    maxAge,
+	}
+}
+
+// Len returns the number of events held, including expired events that have not been dropped yet.
+func (h *History) Len() int {
+	return h.count
+}
+
+// Add adds window events at the given time, dropping the oldest events if the history is full.
+func (h *History) Add(windowEvents []windowevent.WindowEvent, now time.Time) {
+	if h.maxEvents <= 0 {
+		return
+	}
+
+	for _, windowEvent := range windowEvents {
+		if h.count == len(h.entries) && len(h.entries) < h.maxEvents {
+			h.grow()
+		}
+		i := (h.first + h.count) % len(h.entries)
+		h.entries[i] = entry{added: now, event: windowEvent}
+		if h.count < len(h.entries) {
+			h.count++
+		} else {
+			h.first = (h.first + 1) % len(h.entries)
+		}
+	}
+}
+
+// grow doubles the size of the buffer, up to maxEvents, keeping the events held in order.
+func (h *History) grow() {
+	entries := make([]entry, min(max(2*len(h.entries), initialSize), h.maxEvents))
+	for n := 0; n < h.count; n++ {
+		entries[n] = h.entries[(h.first+n)%len(h.entries)]
+	}
+	h.entries = entries
+	h.first = 0
+}
+
+// Events drops the events that expired at the given time and returns the remaining ones, oldest first.
+func (h *History) Events(now time.Time) []windowevent.WindowEvent {
+	for h.count > 0 && h.maxAge > 0 && now.Sub(h.entries[h.first].added) > h.maxAge {
+		h.entries[h.first] = entry{}
+		h.first = (h.first + 1) % len(h.entries)
+		h.count--
+	}
+
+	windowEvents := make([]windowevent.WindowEvent, 0, h.count)
+	for n := 0; n < h.count; n++ {
+		windowEvents = append(windowEvents, h.entries[(h.first+n)%len(h.entries)].event)
+	}
+
+	return windowEvents
+}
+
+// Reset removes all events.
+func (h *History) Reset() {
+	clear(h.entries)
+	h.first = 0
+	h.count = 0
+}
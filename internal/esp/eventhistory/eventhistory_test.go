@@ -0,0 +1,101 @@
+/*
+	Copyright © 2023, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+	SPDX-License-Identifier: Apache-2.0
+*/
+
+package eventhistory
+
+import (
+	"testing"
+	"time"
+
+	"grafana-esp-plugin/internal/esp/field"
+	"grafana-esp-plugin/internal/esp/windowevent"
+)
+
+func newEvents(ids ...int64) []windowevent.WindowEvent {
+	windowEvents := make([]windowevent.WindowEvent, 0, len(ids))
+	for _, id := range ids {
+		windowEvents = append(windowEvents, windowevent.New(time.UnixMicro(id), "insert", []field.Field{field.New("id", id)}))
+	}
+
+	return windowEvents
+}
+
+func assertIds(t *testing.T, windowEvents []windowevent.WindowEvent, expected ...int64) {
+	if len(windowEvents) != len(expected) {
+		t.Fatalf("expected %v events, got %v", len(expected), windowEvents)
+	}
+	for i, windowEvent := range windowEvents {
+		if windowEvent.Fields[0].Value != expected[i] {
+			t.Errorf("expected %v, got %v", expected[i], windowEvent.Fields[0].Value)
+		}
+	}
+}
+
+func TestHistoryKeepsMostRecentEvents(t *testing.T) {
+	h := New(3, 0)
+	now := time.Now()
+
+	h.Add(newEvents(1, 2), now)
+	assertIds(t, h.Events(now), 1, 2)
+
+	h.Add(newEvents(3, 4, 5), now)
+	assertIds(t, h.Events(now), 3, 4, 5)
+
+	h.Add(newEvents(6), now.Add(time.Hour))
+	assertIds(t, h.Events(now.Add(time.Hour)), 4, 5, 6)
+}
+
+func TestHistoryDropsExpiredEvents(t *testing.T) {
+	h := New(10, time.Minute)
+	now := time.Now()
+
+	h.Add(newEvents(1, 2), now)
+	h.Add(newEvents(3), now.Add(30*time.Second))
+	assertIds(t, h.Events(now.Add(time.Minute)), 1, 2, 3)
+	assertIds(t, h.Events(now.Add(61*time.Second)), 3)
+	assertIds(t, h.Events(now.Add(2*time.Minute)))
+
+	h.Add(newEvents(4), now.Add(2*time.Minute))
+	assertIds(t, h.Events(now.Add(2*time.Minute)), 4)
+}
+
+func TestHistoryReset(t *testing.T) {
+	h := New(2, 0)
+	now := time.Now()
+
+	h.Add(newEvents(1, 2), now)
+	h.Reset()
+	if h.Len() != 0 {
+		t.Errorf("expected %v, got %v", 0, h.Len())
+	}
+
+	h.Add(newEvents(3), now)
+	assertIds(t, h.Events(now), 3)
+}
+
+func TestHistoryGrowsUpToMaxEvents(t *testing.T) {
+	h := New(200, 0)
+	now := time.Now()
+
+	if len(h.entries) != 0 {
+		t.Errorf("expected %v, got %v", 0, len(h.entries))
+	}
+
+	ids := make([]int64, 0, 250)
+	for id := int64(1); id <= 250; id++ {
+		ids = append(ids, id)
+	}
+	h.Add(newEvents(ids[:70]...), now)
+	if len(h.entries) != 2*initialSize {
+		t.Errorf("expected %v, got %v", 2*initialSize, len(h.entries))
+	}
+	assertIds(t, h.Events(now), ids[:70]...)
+
+	h.Add(newEvents(ids[70:]...), now)
+	if len(h.entries) != 200 {
+		t.Errorf("expected %v, got %v", 200, len(h.entries))
+	}
+	assertIds(t, h.Events(now), ids[50:]...)
+}
@@ -0,0 +1,384 @@
+/*
+	Copyright © 2023, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+	SPDX-License-Identifier: Apache-2.0
+*/
+
+// Package fakeserver provides an in-memory ESP server for tests. It speaks the ESP websocket protocol, either
+// in-memory through Transport or over the network through Handler, and records the event-stream requests it receives.
+// Messages are sent to connected clients explicitly by the test.
+package fakeserver
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"grafana-esp-plugin/internal/esp/client/messagedto"
+	"grafana-esp-plugin/internal/esp/client/transport"
+
+	"github.com/fxamacker/cbor"
+	"github.com/gorilla/websocket"
+)
+
+type Server struct {
+	lock              sync.Mutex
+	sessions          map[*session]struct{}
+	subscriptions     map[string]subscription
+	requests          []messagedto.StreamMessageDTO
+	changed           chan struct{}
+	projects          []Project
+	authorizedHeaders []string
+}
+
+type subscription struct {
+	session *session
+	request messagedto.StreamMessageDTO
+}
+
+// SchemaField describes a field of a window schema.
+type SchemaField struct {
+	Name string
+	Type string
+	Key  bool
+}
+
+func New() *Server {
+	return &Server{
+		sessions:      make(map[*session]struct{}),
+		subscriptions: make(map[string]subscription),
+		changed:       make(chan struct{}),
+	}
+}
+
+// Transport returns a transport connecting to the server in-memory.
+func (s *Server) Transport() transport.Transport {
+	return memoryTransport{server: s}
+}
+
+// Handler returns an HTTP handler serving the websocket endpoint at /connect and the REST API.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/connect", s.serveWebsocket)
+	mux.HandleFunc("/runningProjects", s.serveRunningProjects)
+
+	return mux
+}
+
+// NextRequest returns the next event-stream request received from any client, in the order of arrival.
+func (s *Server) NextRequest(ctx context.Context) (messagedto.StreamMessageDTO, error) {
+	var request messagedto.StreamMessageDTO
+	err := s.waitFor(ctx, func() bool {
+		if len(s.requests) == 0 {
+			return false
+		}
+
+		request = s.requests[0]
+		s.requests = s.requests[1:]
+		return true
+	})
+
+	return request, err
+}
+
+// WaitForSubscription waits until the subscription with the given id is active on the server.
+func (s *Server) WaitForSubscription(ctx context.Context, subscriptionId string) error {
+	return s.waitFor(ctx, func() bool {
+		_, ok := s.subscriptions[subscriptionId]
+		return ok
+	})
+}
+
+// waitFor waits until the condition, which is evaluated while holding the server lock, is met.
+func (s *Server) waitFor(ctx context.Context, condition func() bool) error {
+	for {
+		s.lock.Lock()
+		isMet := condition()
+		changed := s.changed
+		s.lock.Unlock()
+
+		if isMet {
+			return nil
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// notifyChanged wakes up all waiters. It must be called while holding the server lock.
+func (s *Server) notifyChanged() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// SessionCount returns the number of open client connections.
+func (s *Server) SessionCount() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return len(s.sessions)
+}
+
+// DropConnections closes all client connections, as happens when the server restarts.
+func (s *Server) DropConnections() {
+	for _, sess := range s.allSessions() {
+		sess.close()
+	}
+}
+
+func (s *Server) SendSchema(subscriptionId string, fields []SchemaField) error {
+	schemaFields := make([]map[string]string, 0, len(fields))
+	for _, f := range fields {
+		schemaFields = append(schemaFields, map[string]string{
+			"@name": f.Name,
+			"@type": f.Type,
+			"@key":  fmt.Sprintf("%t", f.Key),
+		})
+	}
+
+	return s.sendToSubscription(subscriptionId, map[string]any{
+		"schema": map[string]any{
+			"@id":    subscriptionId,
+			"fields": schemaFields,
+		},
+	})
+}
+
+// SendEvents sends window events in the format of the subscription. Entries are given in their CBOR
+// representation: timestamps and dates as uint64, blobs as []byte and arrays as []any. For JSON subscriptions the
+// entries are converted the way ESP does.
+func (s *Server) SendEvents(subscriptionId string, entries []map[string]any) error {
+	sub, err := s.subscription(subscriptionId)
+	if err != nil {
+		return err
+	}
+
+	if sub.request.Format == "json" {
+		jsonEntries := make([]map[string]any, 0, len(entries))
+		for _, entry := range entries {
+			jsonEntries = append(jsonEntries, map[string]any{"event": toJsonEntry(entry)})
+		}
+
+		return sub.session.sendJson(map[string]any{
+			"events": map[string]any{"@id": subscriptionId, "entries": jsonEntries},
+		})
+	}
+
+	return sub.session.sendCbor(map[string]any{
+		"events": map[string]any{"@id": subscriptionId, "entries": entries},
+	})
+}
+
+// SendBulk sends a bulk message wrapping the given JSON-encoded messages.
+func (s *Server) SendBulk(subscriptionId string, messages ...any) error {
+	encodedMessages := make([]string, 0, len(messages))
+	for _, message := range messages {
+		messageBytes, err := json.Marshal(message)
+		if err != nil {
+			return err
+		}
+		encodedMessages = append(encodedMessages, base64.StdEncoding.EncodeToString(messageBytes))
+	}
+
+	return s.sendToSubscription(subscriptionId, map[string]any{"bulk": encodedMessages})
+}
+
+// SendError sends an error message. An empty id, or an id that is not of a subscription, sends the error to every
+// client.
+func (s *Server) SendError(id string, text string) error {
+	message := map[string]any{"error": map[string]any{"@id": id, "text": text}}
+	if _, err := s.subscription(id); err != nil {
+		return s.broadcast(message)
+	}
+
+	return s.sendToSubscription(id, message)
+}
+
+func (s *Server) SendProjectLoaded(projectName string) error {
+	return s.broadcast(map[string]any{"project-loaded": map[string]any{"name": projectName}})
+}
+
+func (s *Server) SendProjectRemoved(projectName string) error {
+	return s.broadcast(map[string]any{"project-removed": map[string]any{"name": projectName}})
+}
+
+func (s *Server) SendInfoDiscard(discarded uint64, total uint64) error {
+	return s.broadcast(map[string]any{
+		"info": map[string]any{
+			"type": "event_source_discard",
+			"data": map[string]any{"discarded": discarded, "total": total},
+		},
+	})
+}
+
+func (s *Server) subscription(subscriptionId string) (subscription, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	sub, ok := s.subscriptions[subscriptionId]
+	if !ok {
+		return subscription{}, fmt.Errorf("unknown subscription: %s", subscriptionId)
+	}
+
+	return sub, nil
+}
+
+func (s *Server) sendToSubscription(subscriptionId string, message any) error {
+	sub, err := s.subscription(subscriptionId)
+	if err != nil {
+		return err
+	}
+
+	return sub.session.sendJson(message)
+}
+
+func (s *Server) broadcast(message any) error {
+	for _, sess := range s.allSessions() {
+		err := sess.sendJson(message)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Server) allSessions() []*session {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	sessions := make([]*session, 0, len(s.sessions))
+	for sess := range s.sessions {
+		sessions = append(sessions, sess)
+	}
+
+	return sessions
+}
+
+func (s *Server) openSession(send func(transport.Message) error, closeConn func()) *session {
+	sess := &session{server: s, send: send, closeConn: closeConn}
+
+	s.lock.Lock()
+	s.sessions[sess] = struct{}{}
+	s.notifyChanged()
+	s.lock.Unlock()
+
+	return sess
+}
+
+func (s *Server) closeSession(sess *session) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.sessions, sess)
+	for id, sub := range s.subscriptions {
+		if sub.session == sess {
+			delete(s.subscriptions, id)
+		}
+	}
+	s.notifyChanged()
+}
+
+func (s *Server) handleRequest(sess *session, data []byte) {
+	var message messagedto.SubscriptionMessageDTO
+	if json.Unmarshal(data, &message) != nil {
+		return
+	}
+
+	request := message.EventStream
+
+	s.lock.Lock()
+	switch request.Action {
+	case "set":
+		if sub, ok := s.subscriptions[request.Id]; ok {
+			// Updates only carry the changed settings of an existing subscription.
+			request.Format = sub.request.Format
+		}
+		s.subscriptions[request.Id] = subscription{session: sess, request: request}
+	case "delete":
+		delete(s.subscriptions, request.Id)
+	}
+	s.requests = append(s.requests, request)
+	s.notifyChanged()
+	s.lock.Unlock()
+}
+
+type session struct {
+	server    *Server
+	send      func(transport.Message) error
+	closeConn func()
+	closeOnce sync.Once
+}
+
+func (sess *session) handshake() error {
+	return sess.send(transport.Message{Binary: false, Data: []byte("status: 200\n\n")})
+}
+
+func (sess *session) sendJson(message any) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	return sess.send(transport.Message{Binary: false, Data: data})
+}
+
+func (sess *session) sendCbor(message any) error {
+	data, err := cbor.Marshal(message, cbor.EncOptions{})
+	if err != nil {
+		return err
+	}
+
+	return sess.send(transport.Message{Binary: true, Data: data})
+}
+
+func (sess *session) close() {
+	sess.closeOnce.Do(func() {
+		sess.server.closeSession(sess)
+		sess.closeConn()
+	})
+}
+
+func (s *Server) serveWebsocket(w http.ResponseWriter, r *http.Request) {
+	upgrader := websocket.Upgrader{}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+
+	var writeLock sync.Mutex
+	send := func(message transport.Message) error {
+		messageType := websocket.TextMessage
+		if message.Binary {
+			messageType = websocket.BinaryMessage
+		}
+
+		writeLock.Lock()
+		defer writeLock.Unlock()
+		return conn.WriteMessage(messageType, message.Data)
+	}
+
+	sess := s.openSession(send, func() {
+		_ = conn.Close()
+	})
+	defer sess.close()
+
+	if sess.handshake() != nil {
+		return
+	}
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		s.handleRequest(sess, data)
+	}
+}
@@ -0,0 +1,39 @@
+/*
+	Copyright © 2023, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+	SPDX-License-Identifier: Apache-2.0
+*/
+
+package fakeserver
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// toJsonEntry converts an event entry from its CBOR representation to the one used by the ESP JSON format, in which
+// all values are strings and blobs are maps holding a type signature and the base64-encoded value.
+func toJsonEntry(entry map[string]any) map[string]any {
+	jsonEntry := make(map[string]any, len(entry))
+	for name, value := range entry {
+		switch v := value.(type) {
+		case nil:
+			jsonEntry[name] = nil
+		case string:
+			jsonEntry[name] = v
+		case []byte:
+			jsonEntry[name] = map[string]any{
+				"@type":  http.DetectContentType(v),
+				"*value": base64.StdEncoding.EncodeToString(v),
+			}
+		case []any:
+			arrayBytes, _ := json.Marshal(v)
+			jsonEntry[name] = string(arrayBytes)
+		default:
+			jsonEntry[name] = fmt.Sprint(v)
+		}
+	}
+
+	return jsonEntry
+}
@@ -0,0 +1,92 @@
+/*
+	Copyright © 2023, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+	SPDX-License-Identifier: Apache-2.0
+*/
+
+package fakeserver
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"grafana-esp-plugin/internal/esp/client/transport"
+)
+
+type memoryTransport struct {
+	server *Server
+}
+
+type memoryConnection struct {
+	session   *session
+	messages  chan transport.Message
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+const memoryMessageBufferSize = 1024
+
+func (t memoryTransport) Dial(_ context.Context, _ url.URL, _ http.Header) (transport.Connection, error) {
+	conn := &memoryConnection{
+		messages: make(chan transport.Message, memoryMessageBufferSize),
+		closed:   make(chan struct{}),
+	}
+	conn.session = t.server.openSession(conn.deliver, conn.markClosed)
+
+	err := conn.session.handshake()
+	if err != nil {
+		conn.session.close()
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+func (c *memoryConnection) deliver(message transport.Message) error {
+	select {
+	case c.messages <- message:
+		return nil
+	case <-c.closed:
+		return transport.ErrConnectionClosed
+	}
+}
+
+func (c *memoryConnection) markClosed() {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+	})
+}
+
+func (c *memoryConnection) Read() (transport.Message, error) {
+	select {
+	case message := <-c.messages:
+		return message, nil
+	default:
+	}
+
+	select {
+	case message := <-c.messages:
+		return message, nil
+	case <-c.closed:
+		return transport.Message{}, transport.ErrConnectionClosed
+	}
+}
+
+func (c *memoryConnection) WriteText(data []byte) error {
+	select {
+	case <-c.closed:
+		return transport.ErrConnectionClosed
+	default:
+	}
+
+	c.session.server.handleRequest(c.session, data)
+
+	return nil
+}
+
+func (c *memoryConnection) Close() error {
+	c.session.close()
+
+	return nil
+}
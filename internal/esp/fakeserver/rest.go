@@ -0,0 +1,109 @@
+/*
+	Copyright © 2023, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+	SPDX-License-Identifier: Apache-2.0
+*/
+
+package fakeserver
+
+import (
+	"encoding/xml"
+	"net/http"
+	"slices"
+)
+
+type Project struct {
+	Name              string
+	ContinuousQueries []ContinuousQuery
+}
+
+type ContinuousQuery struct {
+	Name    string
+	Windows []Window
+}
+
+// Window is a window of a running project. Type is the window element name, such as "window-source".
+type Window struct {
+	Name   string
+	Type   string
+	Fields []SchemaField
+}
+
+// SetProjects sets the running projects reported by the REST API.
+func (s *Server) SetProjects(projects []Project) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.projects = projects
+}
+
+// SetAuthorizedHeaders restricts the REST API to requests carrying one of the given Authorization headers. Other
+// requests are rejected with 401 Unauthorized.
+func (s *Server) SetAuthorizedHeaders(authorizationHeaders ...string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.authorizedHeaders = authorizationHeaders
+}
+
+type xmlField struct {
+	Name string `xml:"name,attr"`
+	Type string `xml:"type,attr"`
+	Key  bool   `xml:"key,attr"`
+}
+
+type xmlWindow struct {
+	XMLName xml.Name
+	Name    string     `xml:"name,attr"`
+	Fields  []xmlField `xml:"schema>fields>field"`
+}
+
+type xmlContinuousQuery struct {
+	Name    string      `xml:"name,attr"`
+	Windows []xmlWindow `xml:"windows>any"`
+}
+
+type xmlProject struct {
+	Name              string               `xml:"name,attr"`
+	ContinuousQueries []xmlContinuousQuery `xml:"contqueries>contquery"`
+}
+
+type xmlProjects struct {
+	XMLName  xml.Name     `xml:"projects"`
+	Projects []xmlProject `xml:"project"`
+}
+
+func (s *Server) serveRunningProjects(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	if s.authorizedHeaders != nil && !slices.Contains(s.authorizedHeaders, r.Header.Get("Authorization")) {
+		s.lock.Unlock()
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	projects := xmlProjects{}
+	for _, p := range s.projects {
+		project := xmlProject{Name: p.Name}
+		for _, cq := range p.ContinuousQueries {
+			continuousQuery := xmlContinuousQuery{Name: cq.Name}
+			for _, win := range cq.Windows {
+				window := xmlWindow{XMLName: xml.Name{Local: win.Type}, Name: win.Name}
+				for _, f := range win.Fields {
+					window.Fields = append(window.Fields, xmlField{Name: f.Name, Type: f.Type, Key: f.Key})
+				}
+				continuousQuery.Windows = append(continuousQuery.Windows, window)
+			}
+			project.ContinuousQueries = append(project.ContinuousQueries, continuousQuery)
+		}
+		projects.Projects = append(projects.Projects, project)
+	}
+	s.lock.Unlock()
+
+	body, err := xml.Marshal(projects)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	_, _ = w.Write(body)
+}
@@ -0,0 +1,68 @@
+/*
+	Copyright © 2023, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+	SPDX-License-Identifier: Apache-2.0
+*/
+
+package field
+
+import (
+	"encoding/base64"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+const defaultBlobContentType = "application/octet-stream"
+
+// BlobValue is the value of an ESP blob field along with the content type of its data.
+type BlobValue struct {
+	ContentType string
+	Data        []byte
+}
+
+// NewBlobValue returns a blob value holding the given data. The content type is detected from the magic bytes of the
+// data, falling back to the type hint sent by the ESP server, which is either a MIME type or a file extension.
+func NewBlobValue(data []byte, typeHint string) BlobValue {
+	contentType := http.DetectContentType(data)
+	if !strings.HasPrefix(contentType, "image/") {
+		if hintedType := parseBlobTypeHint(typeHint); hintedType != "" {
+			contentType = hintedType
+		}
+	}
+
+	return BlobValue{ContentType: contentType, Data: data}
+}
+
+// parseBlobTypeHint returns the MIME type denoted by a blob type hint, or an empty string if it denotes none.
+func parseBlobTypeHint(typeHint string) string {
+	typeHint = strings.ToLower(strings.TrimSpace(typeHint))
+	if typeHint == "" {
+		return ""
+	}
+
+	if !strings.Contains(typeHint, "/") {
+		typeHint = mime.TypeByExtension("." + strings.TrimPrefix(typeHint, "."))
+	}
+
+	mediaType, _, err := mime.ParseMediaType(typeHint)
+	if err != nil || mediaType == defaultBlobContentType {
+		return ""
+	}
+
+	return mediaType
+}
+
+// IsImage reports whether the data of the blob is an image.
+func (blob BlobValue) IsImage() bool {
+	return strings.HasPrefix(blob.ContentType, "image/")
+}
+
+// String returns the data of the blob encoded as base64, as a data URI if the blob is an image.
+func (blob BlobValue) String() string {
+	encodedData := base64.StdEncoding.EncodeToString(blob.Data)
+	if blob.IsImage() {
+		return "data:" + blob.ContentType + ";base64," + encodedData
+	}
+
+	return encodedData
+}
@@ -11,8 +11,9 @@ import (
 )
 
 type Field struct {
-	Name  string
-	Value any
+	Name   string
+	Value  any
+	Schema *SchemaField
 }
 
 func New(fieldName string, fieldValue any) Field {
@@ -24,43 +25,80 @@ func New(fieldName string, fieldValue any) Field {
 	return field
 }
 
+// FromSchema returns a field holding a value of the given schema field.
+func FromSchema(schemaField *SchemaField, fieldValue any) Field {
+	field := New(schemaField.Name, fieldValue)
+	field.Schema = schemaField
+
+	return field
+}
+
+// IsKey reports whether the field is a key field of its window.
+func (field Field) IsKey() bool {
+	return field.Schema != nil && field.Schema.Key
+}
+
 func (field Field) String() string {
 	return fmt.Sprintf("Field{name=%s, value=%s}", field.Name, field.Value)
 }
 
+// SchemaType is the exact type of an ESP window field.
 type SchemaType int
 
 const (
-	Array SchemaType = iota
-	Blob
+	Unknown SchemaType = iota
+	Int32
+	Int64
 	Double
-	Int
-	Timestamp
+	Money
+	ArrayDouble
+	ArrayInt32
+	ArrayInt64
 	String
+	RString
+	Timestamp
 	Date
+	Blob
 )
 
 var (
 	fieldTypeMap = map[string]SchemaType{
-		"array(dbl)": Array,
-		"array(i32)": Array,
-		"array(i64)": Array,
+		"array(dbl)": ArrayDouble,
+		"array(i32)": ArrayInt32,
+		"array(i64)": ArrayInt64,
 		"blob":       Blob,
 		"date":       Date,
 		"double":     Double,
-		"int32":      Int,
-		"int64":      Int,
-		"money":      Double,
-		"rstring":    String,
+		"int32":      Int32,
+		"int64":      Int64,
+		"money":      Money,
+		"rstring":    RString,
 		"stamp":      Timestamp,
 		"string":     String,
 	}
 )
 
+func (schemaType SchemaType) String() string {
+	for name, t := range fieldTypeMap {
+		if t == schemaType {
+			return name
+		}
+	}
+
+	return "unknown"
+}
+
+// IsArray reports whether values of the type are arrays.
+func (schemaType SchemaType) IsArray() bool {
+	return schemaType == ArrayDouble || schemaType == ArrayInt32 || schemaType == ArrayInt64
+}
+
+// ParseFieldTypeFromString returns the schema type of an ESP type name. Unknown is returned along with an error for
+// types that are not supported.
 func ParseFieldTypeFromString(str string) (SchemaType, error) {
 	fieldType, ok := fieldTypeMap[strings.ToLower(str)]
 	if !ok {
-		return fieldType, fmt.Errorf("unknown schema field type: %s", str)
+		return Unknown, fmt.Errorf("unknown schema field type: %s", str)
 	}
 	return fieldType, nil
 }
@@ -0,0 +1,97 @@
+/*
+	Copyright © 2023, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+	SPDX-License-Identifier: Apache-2.0
+*/
+
+package field
+
+import (
+	"testing"
+)
+
+func TestParseFieldTypeFromString(t *testing.T) {
+	for typeName, expected := range fieldTypeMap {
+		actual, err := ParseFieldTypeFromString(typeName)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if expected != actual {
+			t.Errorf("expected %v, got %v", expected, actual)
+		}
+		if actual.String() != typeName {
+			t.Errorf("expected %v, got %v", typeName, actual.String())
+		}
+	}
+
+	actual, err := ParseFieldTypeFromString("geometry")
+	if err == nil {
+		t.Errorf("expected non-nil error")
+	}
+	if actual != Unknown {
+		t.Errorf("expected %v, got %v", Unknown, actual)
+	}
+}
+
+func TestSchemaField(t *testing.T) {
+	schema := NewSchema([]*SchemaField{
+		{Name: "id", Type: Int64, TypeName: "int64", Precision: -1},
+		{Name: "price", Type: Money, TypeName: "money", Precision: 2},
+	})
+
+	schemaField, ok := schema.Field("price")
+	if !ok || schemaField != schema.Fields[1] {
+		t.Errorf("expected %v, got %v", schema.Fields[1], schemaField)
+	}
+
+	_, ok = schema.Field("missing")
+	if ok {
+		t.Errorf("expected missing field not to be found")
+	}
+}
+
+func TestSchemaSelect(t *testing.T) {
+	schema := NewSchema([]*SchemaField{
+		{Name: "id", Type: Int64, TypeName: "int64", Precision: -1},
+		{Name: "price", Type: Money, TypeName: "money", Precision: 2},
+		{Name: "name", Type: String, TypeName: "string", Precision: -1},
+	})
+
+	selected := schema.Select([]string{"name", "missing", "id"})
+	if len(selected.Fields) != 2 || selected.Fields[0].Name != "id" || selected.Fields[1].Name != "name" {
+		t.Errorf("expected fields id and name, got %v", selected.Fields)
+	}
+	if _, ok := selected.Field("price"); ok {
+		t.Errorf("expected unselected field not to be found")
+	}
+
+	if schema.Select(nil) != schema {
+		t.Errorf("expected whole schema")
+	}
+}
+
+func TestNewBlobValue(t *testing.T) {
+	png := []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1a, '\n'}
+	tests := []struct {
+		data                []byte
+		typeHint            string
+		expectedContentType string
+		expectedString      string
+	}{
+		{png, "", "image/png", "data:image/png;base64,iVBORw0KGgo="},
+		{png, "jpg", "image/png", "data:image/png;base64,iVBORw0KGgo="},
+		{[]byte{0, 1}, "jpg", "image/jpeg", "data:image/jpeg;base64,AAE="},
+		{[]byte{0, 1}, "image/jpeg", "image/jpeg", "data:image/jpeg;base64,AAE="},
+		{[]byte{0, 1}, "", "application/octet-stream", "AAE="},
+		{[]byte{0, 1}, "unknown", "application/octet-stream", "AAE="},
+	}
+
+	for _, test := range tests {
+		blob := NewBlobValue(test.data, test.typeHint)
+		if blob.ContentType != test.expectedContentType {
+			t.Errorf("expected %v, got %v", test.expectedContentType, blob.ContentType)
+		}
+		if blob.String() != test.expectedString {
+			t.Errorf("expected %v, got %v", test.expectedString, blob.String())
+		}
+	}
+}
@@ -0,0 +1,97 @@
+/*
+	Copyright © 2023, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+	SPDX-License-Identifier: Apache-2.0
+*/
+
+package field
+
+// SchemaField describes a field of a window schema. TypeName holds the type as named by the server, which is kept
+// for fields of Unknown type. Precision is the number of decimal places of money fields, or -1 if the server did not
+// provide it. Key fields together identify an event of the window.
+type SchemaField struct {
+	Name      string
+	Type      SchemaType
+	TypeName  string
+	Precision int
+	Key       bool
+}
+
+// Schema is the ordered list of fields of a window.
+type Schema struct {
+	Fields  []*SchemaField
+	indices map[string]int
+}
+
+func NewSchema(fields []*SchemaField) *Schema {
+	indices := make(map[string]int, len(fields))
+	for i, f := range fields {
+		indices[f.Name] = i
+	}
+
+	return &Schema{
+		Fields:  fields,
+		indices: indices,
+	}
+}
+
+// KeyFields returns the key fields of the schema, in schema order.
+func (schema *Schema) KeyFields() []*SchemaField {
+	keyFields := make([]*SchemaField, 0)
+	for _, f := range schema.Fields {
+		if f.Key {
+			keyFields = append(keyFields, f)
+		}
+	}
+
+	return keyFields
+}
+
+// Field returns the schema field of the given name.
+func (schema *Schema) Field(name string) (*SchemaField, bool) {
+	i, ok := schema.indices[name]
+	if !ok {
+		return nil, false
+	}
+
+	return schema.Fields[i], true
+}
+
+// Select returns the schema of the fields of the given names, in schema order. Names that are not fields of the
+// schema are ignored. The whole schema is returned if no names are given.
+func (schema *Schema) Select(names []string) *Schema {
+	if len(names) == 0 {
+		return schema
+	}
+
+	selected := make(map[string]bool, len(names))
+	for _, name := range names {
+		selected[name] = true
+	}
+
+	fields := make([]*SchemaField, 0, len(names))
+	for _, f := range schema.Fields {
+		if selected[f.Name] {
+			fields = append(fields, f)
+		}
+	}
+
+	return NewSchema(fields)
+}
+
+// Equal reports whether both schemas have the same fields in the same order.
+func (schema *Schema) Equal(other *Schema) bool {
+	if schema == nil || other == nil {
+		return schema == other
+	}
+	if len(schema.Fields) != len(other.Fields) {
+		return false
+	}
+
+	for i, f := range schema.Fields {
+		if *f != *other.Fields[i] {
+			return false
+		}
+	}
+
+	return true
+}
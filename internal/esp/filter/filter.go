@@ -0,0 +1,493 @@
+/*
+	Copyright © 2023, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+	SPDX-License-Identifier: Apache-2.0
+*/
+
+// Package filter parses and evaluates filter expressions on window events, such as severity = 'HIGH' and
+// value > 10. Expressions compare fields with literals or other fields using =, ==, !=, <>, <, <=, > and >=, and are
+// combined using and, or, not and parentheses. Literals are strings in single or double quotes, numbers, true,
+// false and null. The opcode of an event is available as @opcode.
+package filter
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"grafana-esp-plugin/internal/esp/field"
+	"grafana-esp-plugin/internal/esp/windowevent"
+)
+
+// OpcodeFieldName is the name by which expressions refer to the opcode of an event.
+const OpcodeFieldName = "@opcode"
+
+// Expression is a parsed filter expression.
+type Expression struct {
+	source string
+	root   node
+	fields []string
+}
+
+// Parse parses a filter expression.
+func Parse(source string) (*Expression, error) {
+	tokens, err := tokenize(source)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != tokenEnd {
+		return nil, fmt.Errorf("unexpected %s in filter expression", p.peek())
+	}
+
+	return &Expression{source: source, root: root, fields: p.fields}, nil
+}
+
+func (e *Expression) String() string {
+	return e.source
+}
+
+// Fields returns the names of the window fields that the expression refers to, in order of appearance.
+func (e *Expression) Fields() []string {
+	return e.fields
+}
+
+// Matches reports whether a window event satisfies the expression.
+func (e *Expression) Matches(windowEvent windowevent.WindowEvent) bool {
+	return isTrue(e.root.eval(windowEvent))
+}
+
+// Filter returns the window events that satisfy the expression.
+func (e *Expression) Filter(windowEvents []windowevent.WindowEvent) []windowevent.WindowEvent {
+	filtered := make([]windowevent.WindowEvent, 0, len(windowEvents))
+	for _, windowEvent := range windowEvents {
+		if e.Matches(windowEvent) {
+			filtered = append(filtered, windowEvent)
+		}
+	}
+
+	return filtered
+}
+
+type node interface {
+	eval(windowEvent windowevent.WindowEvent) any
+}
+
+type literalNode struct {
+	value any
+}
+
+func (n literalNode) eval(windowevent.WindowEvent) any {
+	return n.value
+}
+
+type fieldNode struct {
+	name string
+}
+
+func (n fieldNode) eval(windowEvent windowevent.WindowEvent) any {
+	if n.name == OpcodeFieldName {
+		return windowEvent.Opcode
+	}
+
+	for _, f := range windowEvent.Fields {
+		if f.Name == n.name {
+			return normalize(f.Value)
+		}
+	}
+
+	return nil
+}
+
+type notNode struct {
+	operand node
+}
+
+func (n notNode) eval(windowEvent windowevent.WindowEvent) any {
+	return !isTrue(n.operand.eval(windowEvent))
+}
+
+type logicalNode struct {
+	and         bool
+	left, right node
+}
+
+func (n logicalNode) eval(windowEvent windowevent.WindowEvent) any {
+	if n.and {
+		return isTrue(n.left.eval(windowEvent)) && isTrue(n.right.eval(windowEvent))
+	}
+
+	return isTrue(n.left.eval(windowEvent)) || isTrue(n.right.eval(windowEvent))
+}
+
+type comparisonNode struct {
+	operator    string
+	left, right node
+}
+
+func (n comparisonNode) eval(windowEvent windowevent.WindowEvent) any {
+	left := n.left.eval(windowEvent)
+	right := n.right.eval(windowEvent)
+
+	// Null only equals null, and is neither less nor greater than any value.
+	if left == nil || right == nil {
+		switch n.operator {
+		case "=":
+			return left == nil && right == nil
+		case "!=":
+			return (left == nil) != (right == nil)
+		default:
+			return false
+		}
+	}
+
+	order, ok := compare(left, right)
+	if !ok {
+		return n.operator == "!="
+	}
+
+	switch n.operator {
+	case "=":
+		return order == 0
+	case "!=":
+		return order != 0
+	case "<":
+		return order < 0
+	case "<=":
+		return order <= 0
+	case ">":
+		return order > 0
+	default:
+		return order >= 0
+	}
+}
+
+// normalize converts field values to the types compared by expressions: float64, string, bool, time.Time or nil.
+func normalize(value any) any {
+	v := reflect.ValueOf(value)
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+		value = v.Interface()
+	}
+
+	switch t := value.(type) {
+	case string, bool, time.Time:
+		return t
+	case field.BlobValue:
+		return t.String()
+	}
+
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// compare orders two non-null values, reporting false if they cannot be compared. Times are compared with strings
+// holding RFC 3339 times, and with numbers holding Unix times in microseconds, as ESP stamps are.
+func compare(left any, right any) (int, bool) {
+	switch l := left.(type) {
+	case float64:
+		switch r := right.(type) {
+		case float64:
+			return compareOrdered(l, r), true
+		case time.Time:
+			return compareOrdered(l, float64(r.UnixMicro())), true
+		}
+	case string:
+		switch r := right.(type) {
+		case string:
+			return strings.Compare(l, r), true
+		case time.Time:
+			if parsed, err := time.Parse(time.RFC3339Nano, l); err == nil {
+				return parsed.Compare(r), true
+			}
+		}
+	case bool:
+		if r, ok := right.(bool); ok {
+			switch {
+			case l == r:
+				return 0, true
+			case !l:
+				return -1, true
+			default:
+				return 1, true
+			}
+		}
+	case time.Time:
+		order, ok := compare(right, left)
+		return -order, ok
+	}
+
+	return 0, false
+}
+
+func compareOrdered(l float64, r float64) int {
+	switch {
+	case l < r:
+		return -1
+	case l > r:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func isTrue(value any) bool {
+	b, ok := value.(bool)
+	return ok && b
+}
+
+type tokenKind int
+
+const (
+	tokenEnd tokenKind = iota
+	tokenIdentifier
+	tokenString
+	tokenNumber
+	tokenOperator
+	tokenOpen
+	tokenClose
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+func (t token) String() string {
+	if t.kind == tokenEnd {
+		return "end"
+	}
+
+	return fmt.Sprintf("'%s'", t.text)
+}
+
+func tokenize(source string) ([]token, error) {
+	var tokens []token
+	runes := []rune(source)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, token{tokenOpen, "("})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{tokenClose, ")"})
+			i++
+		case r == '\'' || r == '"':
+			var text strings.Builder
+			j := i + 1
+			for ; j < len(runes); j++ {
+				if runes[j] == r {
+					// A doubled quote stands for the quote itself.
+					if j+1 < len(runes) && runes[j+1] == r {
+						text.WriteRune(r)
+						j++
+						continue
+					}
+					break
+				}
+				text.WriteRune(runes[j])
+			}
+			if j >= len(runes) {
+				return nil, fmt.Errorf("unterminated string in filter expression")
+			}
+			tokens = append(tokens, token{tokenString, text.String()})
+			i = j + 1
+		case unicode.IsDigit(r) || (r == '-' || r == '.') && i+1 < len(runes) && unicode.IsDigit(runes[i+1]):
+			j := i + 1
+			for j < len(runes) && (unicode.IsDigit(runes[j]) || strings.ContainsRune(".eE", runes[j]) || (runes[j] == '-' || runes[j] == '+') && strings.ContainsRune("eE", runes[j-1])) {
+				j++
+			}
+			tokens = append(tokens, token{tokenNumber, string(runes[i:j])})
+			i = j
+		case isIdentifierRune(r, true):
+			j := i + 1
+			for j < len(runes) && isIdentifierRune(runes[j], false) {
+				j++
+			}
+			tokens = append(tokens, token{tokenIdentifier, string(runes[i:j])})
+			i = j
+		default:
+			operator := ""
+			for _, candidate := range []string{"==", "!=", "<>", "<=", ">=", "&&", "||", "=", "<", ">", "!"} {
+				if strings.HasPrefix(string(runes[i:]), candidate) {
+					operator = candidate
+					break
+				}
+			}
+			if operator == "" {
+				return nil, fmt.Errorf("unexpected character '%c' in filter expression", r)
+			}
+			tokens = append(tokens, token{tokenOperator, operator})
+			i += len(operator)
+		}
+	}
+
+	return append(tokens, token{kind: tokenEnd}), nil
+}
+
+func isIdentifierRune(r rune, first bool) bool {
+	return unicode.IsLetter(r) || r == '_' || r == '@' || !first && (unicode.IsDigit(r) || r == '.')
+}
+
+type parser struct {
+	tokens []token
+	next   int
+	fields []string
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.next]
+}
+
+func (p *parser) accept(texts ...string) (string, bool) {
+	t := p.peek()
+	if t.kind != tokenOperator && t.kind != tokenIdentifier {
+		return "", false
+	}
+	for _, text := range texts {
+		if strings.EqualFold(t.text, text) {
+			p.next++
+			return text, true
+		}
+	}
+
+	return "", false
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		if _, ok := p.accept("or", "||"); !ok {
+			return left, nil
+		}
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = logicalNode{and: false, left: left, right: right}
+	}
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		if _, ok := p.accept("and", "&&"); !ok {
+			return left, nil
+		}
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = logicalNode{and: true, left: left, right: right}
+	}
+}
+
+func (p *parser) parseNot() (node, error) {
+	if _, ok := p.accept("not", "!"); ok {
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{operand: operand}, nil
+	}
+
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (node, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	operator, ok := p.accept("==", "!=", "<>", "<=", ">=", "=", "<", ">")
+	if !ok {
+		return left, nil
+	}
+	switch operator {
+	case "==":
+		operator = "="
+	case "<>":
+		operator = "!="
+	}
+
+	right, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	return comparisonNode{operator: operator, left: left, right: right}, nil
+}
+
+func (p *parser) parseOperand() (node, error) {
+	t := p.peek()
+	p.next++
+
+	switch t.kind {
+	case tokenOpen:
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek().kind != tokenClose {
+			return nil, fmt.Errorf("expected ')' instead of %s in filter expression", p.peek())
+		}
+		p.next++
+		return inner, nil
+	case tokenString:
+		return literalNode{value: t.text}, nil
+	case tokenNumber:
+		number, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number '%s' in filter expression", t.text)
+		}
+		return literalNode{value: number}, nil
+	case tokenIdentifier:
+		switch strings.ToLower(t.text) {
+		case "true":
+			return literalNode{value: true}, nil
+		case "false":
+			return literalNode{value: false}, nil
+		case "null":
+			return literalNode{value: nil}, nil
+		case "and", "or", "not":
+			return nil, fmt.Errorf("unexpected '%s' in filter expression", t.text)
+		}
+		if t.text != OpcodeFieldName && !slices.Contains(p.fields, t.text) {
+			p.fields = append(p.fields, t.text)
+		}
+		return fieldNode{name: t.text}, nil
+	default:
+		return nil, fmt.Errorf("unexpected %s in filter expression", t)
+	}
+}
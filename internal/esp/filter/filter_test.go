@@ -0,0 +1,99 @@
+/*
+	Copyright © 2023, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+	SPDX-License-Identifier: Apache-2.0
+*/
+
+package filter
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"grafana-esp-plugin/internal/esp/field"
+	"grafana-esp-plugin/internal/esp/windowevent"
+)
+
+func newAlertEvent() windowevent.WindowEvent {
+	value := 12.5
+	return windowevent.New(time.UnixMicro(0), "insert", []field.Field{
+		field.New("id", int64(7)),
+		field.New("severity", "HIGH"),
+		field.New("value", &value),
+		field.New("acknowledged", false),
+		field.New("comment", (*string)(nil)),
+		field.New("raised", time.UnixMilli(1000).UTC()),
+	})
+}
+
+func TestExpressionMatches(t *testing.T) {
+	windowEvent := newAlertEvent()
+
+	for source, expected := range map[string]bool{
+		"severity = 'HIGH'":                           true,
+		"severity == \"HIGH\"":                        true,
+		"severity != 'HIGH'":                          false,
+		"severity <> 'LOW'":                           true,
+		"value > 10":                                  true,
+		"value >= 12.5 and id < 7":                    false,
+		"value >= 12.5 AND id <= 7":                   true,
+		"id = 1 or (severity = 'HIGH' && value < 20)": true,
+		"not acknowledged":                            true,
+		"!(acknowledged = false)":                     false,
+		"comment = null":                              true,
+		"comment != null":                             false,
+		"comment > 'a'":                               false,
+		"missing = null":                              true,
+		"severity = 5":                                false,
+		"@opcode = 'insert'":                          true,
+		"raised > '1970-01-01T00:00:00.5Z'":           true,
+		"raised = 1000000":                            true,
+		"id = -7 or id = 7e0":                         true,
+		"severity = 'it''s'":                          false,
+	} {
+		expression, err := Parse(source)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", source, err)
+			continue
+		}
+		if matches := expression.Matches(windowEvent); matches != expected {
+			t.Errorf("%s: expected %v, got %v", source, expected, matches)
+		}
+	}
+}
+
+func TestExpressionFields(t *testing.T) {
+	expression, err := Parse("severity = 'HIGH' and (value > limit or severity = 'LOW') and @opcode != 'delete'")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []string{"severity", "value", "limit"}
+	if !slices.Equal(expression.Fields(), expected) {
+		t.Errorf("expected %v, got %v", expected, expression.Fields())
+	}
+}
+
+func TestExpressionFilter(t *testing.T) {
+	expression, err := Parse("id > 1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	windowEvents := []windowevent.WindowEvent{
+		windowevent.New(time.UnixMicro(0), "insert", []field.Field{field.New("id", int32(1))}),
+		windowevent.New(time.UnixMicro(0), "insert", []field.Field{field.New("id", int32(2))}),
+	}
+	filtered := expression.Filter(windowEvents)
+	if len(filtered) != 1 || filtered[0].Fields[0].Value != int32(2) {
+		t.Errorf("expected event of id 2, got %v", filtered)
+	}
+}
+
+func TestParseInvalidExpressions(t *testing.T) {
+	for _, source := range []string{"", "severity =", "severity = 'HIGH", "(value > 1", "value > 1)", "value ? 1", "and value"} {
+		if _, err := Parse(source); err == nil {
+			t.Errorf("%s: expected non-nil error", source)
+		}
+	}
+}
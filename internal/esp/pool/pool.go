@@ -0,0 +1,238 @@
+/*
+	Copyright © 2023, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+	SPDX-License-Identifier: Apache-2.0
+*/
+
+package pool
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net/url"
+	"sync"
+
+	"grafana-esp-plugin/internal/esp/client"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+// Pool shares ESP websocket connections between streams. Connections are keyed by server URL and credentials, and
+// are closed once the last lease on them has been released.
+type Pool struct {
+	connections map[string]*connection
+	lock        sync.Mutex
+	newClient   func(url.URL, *string) *client.EspWsClient
+}
+
+type connection struct {
+	key    string
+	client *client.EspWsClient
+	leases map[*Lease]struct{}
+}
+
+// Lease is a reference to a pooled connection. Connection-wide events of the connection are emitted on Events,
+// which should be drained until the lease is released. Events are queued per lease, so that a lease falling behind
+// does not hold up the other leases on the connection.
+type Lease struct {
+	pool        *Pool
+	conn        *connection
+	subs        []*client.Subscription
+	events      chan client.Event
+	queue       []client.Event
+	queueLock   sync.Mutex
+	queued      chan struct{}
+	released    chan struct{}
+	releaseOnce sync.Once
+}
+
+// Up to leaseEventQueueSize events are queued for a lease, beyond which its oldest events are dropped.
+const (
+	leaseEventBufferSize = 16
+	leaseEventQueueSize  = 1024
+)
+
+// New returns an empty pool. Clients opened by the pool handle undecodable events according to decodeErrorPolicy.
+func New(decodeErrorPolicy client.DecodeErrorPolicy) *Pool {
+	return &Pool{
+		connections: make(map[string]*connection),
+		lock:        sync.Mutex{},
+		newClient: func(serverUrl url.URL, authorizationHeader *string) *client.EspWsClient {
+			c := client.New(serverUrl, authorizationHeader)
+			c.DecodeErrorPolicy = decodeErrorPolicy
+			return c
+		},
+	}
+}
+
+// Acquire returns a lease on the connection to the given server, opening a new connection if none exists yet.
+func (p *Pool) Acquire(serverUrl url.URL, authorizationHeader *string) *Lease {
+	key := connectionKey(serverUrl, authorizationHeader)
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	conn, ok := p.connections[key]
+	if !ok {
+		conn = &connection{
+			key:    key,
+			client: p.newClient(serverUrl, authorizationHeader),
+			leases: make(map[*Lease]struct{}),
+		}
+		p.connections[key] = conn
+		conn.client.Connect(context.Background())
+		go p.route(conn)
+	}
+
+	lease := &Lease{
+		pool:     p,
+		conn:     conn,
+		events:   make(chan client.Event, leaseEventBufferSize),
+		queued:   make(chan struct{}, 1),
+		released: make(chan struct{}),
+	}
+	conn.leases[lease] = struct{}{}
+	go lease.forward()
+
+	log.DefaultLogger.Debug("Acquired pooled ESP connection", "url", serverUrl.String(), "leases", len(conn.leases))
+
+	return lease
+}
+
+// Events returns the channel of connection-wide events of the leased connection.
+func (l *Lease) Events() <-chan client.Event {
+	return l.events
+}
+
+// Subscribe subscribes to a window over the shared connection. Subscriptions still active when the lease is
+// released are cancelled.
+func (l *Lease) Subscribe(projectName string, cqName string, windowName string, interval uint64, maxEvents uint64, fields []string, format string, keepKeyFields bool) (*client.Subscription, error) {
+	sub, err := l.conn.client.Subscribe(projectName, cqName, windowName, interval, maxEvents, fields, format, keepKeyFields)
+	if err != nil {
+		return nil, err
+	}
+
+	l.pool.lock.Lock()
+	l.subs = append(l.subs, sub)
+	l.pool.lock.Unlock()
+
+	return sub, nil
+}
+
+// Release gives up the lease. The underlying connection is closed when no leases remain.
+func (l *Lease) Release() {
+	p := l.pool
+
+	p.lock.Lock()
+	conn := l.conn
+	if _, ok := conn.leases[l]; !ok {
+		p.lock.Unlock()
+		return
+	}
+
+	delete(conn.leases, l)
+	isLastLease := len(conn.leases) == 0
+	if isLastLease {
+		delete(p.connections, conn.key)
+	}
+	subs := l.subs
+	l.subs = nil
+	p.lock.Unlock()
+
+	l.releaseOnce.Do(func() {
+		close(l.released)
+	})
+
+	for _, sub := range subs {
+		err := sub.Cancel()
+		if err != nil {
+			log.DefaultLogger.Error("Unable to cancel subscription", "subscriptionId", sub.Id(), "error", err)
+		}
+	}
+
+	if isLastLease {
+		log.DefaultLogger.Debug("Closing pooled ESP connection")
+		conn.client.Close()
+	}
+}
+
+// route forwards the connection-wide events of a client to all leases on its connection until the client stops.
+func (p *Pool) route(conn *connection) {
+	for event := range conn.client.Events() {
+		for _, lease := range p.leasesOf(conn) {
+			lease.enqueue(event)
+		}
+	}
+}
+
+// enqueue queues an event for the lease without blocking.
+func (l *Lease) enqueue(event client.Event) {
+	l.queueLock.Lock()
+	if len(l.queue) >= leaseEventQueueSize {
+		log.DefaultLogger.Warn("Dropped connection event of lease falling behind", "event", fmt.Sprintf("%T", l.queue[0]))
+		l.queue = l.queue[1:]
+	}
+	l.queue = append(l.queue, event)
+	l.queueLock.Unlock()
+
+	select {
+	case l.queued <- struct{}{}:
+	default:
+	}
+}
+
+// forward emits the queued events of the lease on Events until the lease is released.
+func (l *Lease) forward() {
+	for {
+		select {
+		case <-l.queued:
+		case <-l.released:
+			return
+		}
+
+		for {
+			l.queueLock.Lock()
+			if len(l.queue) == 0 {
+				l.queueLock.Unlock()
+				break
+			}
+			event := l.queue[0]
+			l.queue = l.queue[1:]
+			l.queueLock.Unlock()
+
+			select {
+			case l.events <- event:
+			case <-l.released:
+				return
+			}
+		}
+	}
+}
+
+func (p *Pool) leasesOf(conn *connection) []*Lease {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	leases := make([]*Lease, 0, len(conn.leases))
+	for lease := range conn.leases {
+		leases = append(leases, lease)
+	}
+
+	return leases
+}
+
+func connectionKey(serverUrl url.URL, authorizationHeader *string) string {
+	var authorization string
+	if authorizationHeader != nil {
+		authorization = *authorizationHeader
+	}
+
+	b := bytes.Join([][]byte{
+		[]byte(serverUrl.String()),
+		[]byte(authorization),
+	}, []byte{0})
+	hashSum := sha256.Sum256(b)
+
+	return fmt.Sprintf("%x", hashSum)
+}
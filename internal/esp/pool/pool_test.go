@@ -0,0 +1,163 @@
+/*
+	Copyright © 2023, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+	SPDX-License-Identifier: Apache-2.0
+*/
+
+package pool
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+
+	"grafana-esp-plugin/internal/esp/client"
+	"grafana-esp-plugin/internal/esp/fakeserver"
+)
+
+func parseUrl(t *testing.T, urlString string) url.URL {
+	u, err := url.Parse(urlString)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	return *u
+}
+
+func TestAcquireSharesConnectionPerServerAndCredentials(t *testing.T) {
+	p := New(client.DecodeErrorPolicyNullField)
+	serverUrl := parseUrl(t, "ws://127.0.0.1:1/connect")
+	otherServerUrl := parseUrl(t, "ws://127.0.0.1:2/connect")
+	authHeader := "Bearer foo"
+
+	l1 := p.Acquire(serverUrl, nil)
+	l2 := p.Acquire(serverUrl, nil)
+	l3 := p.Acquire(serverUrl, &authHeader)
+	l4 := p.Acquire(otherServerUrl, nil)
+
+	if l1.conn != l2.conn {
+		t.Errorf("expected leases on the same server and credentials to share a connection")
+	}
+
+	if l1.conn == l3.conn || l1.conn == l4.conn {
+		t.Errorf("expected leases on different servers or credentials to use separate connections")
+	}
+
+	if len(p.connections) != 3 {
+		t.Errorf("expected %v, got %v", 3, len(p.connections))
+	}
+
+	l1.Release()
+	if len(p.connections) != 3 {
+		t.Errorf("expected %v, got %v", 3, len(p.connections))
+	}
+
+	l2.Release()
+	l2.Release()
+	l3.Release()
+	l4.Release()
+	if len(p.connections) != 0 {
+		t.Errorf("expected %v, got %v", 0, len(p.connections))
+	}
+}
+
+func TestReleaseClosesSharedConnection(t *testing.T) {
+	s := fakeserver.New()
+	p := New(client.DecodeErrorPolicyNullField)
+	p.newClient = func(serverUrl url.URL, authorizationHeader *string) *client.EspWsClient {
+		c := client.New(serverUrl, authorizationHeader)
+		c.Transport = s.Transport()
+		return c
+	}
+	serverUrl := parseUrl(t, "ws://esp/connect")
+
+	l1 := p.Acquire(serverUrl, nil)
+	l2 := p.Acquire(serverUrl, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	sub1, err := l1.Subscribe("project", "cq", "window", 0, 0, nil, "", false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	sub2, err := l2.Subscribe("project", "cq", "window", 0, 0, nil, "", false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for _, sub := range []*client.Subscription{sub1, sub2} {
+		err = s.WaitForSubscription(ctx, sub.Id())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	if s.SessionCount() != 1 {
+		t.Errorf("expected %v, got %v", 1, s.SessionCount())
+	}
+
+	l1.Release()
+	request, err := s.NextRequest(ctx)
+	for err == nil && request.Action != "delete" {
+		request, err = s.NextRequest(ctx)
+	}
+	if err != nil || request.Id != sub1.Id() {
+		t.Errorf("expected delete request for %s, got %v", sub1.Id(), request)
+	}
+	if s.SessionCount() != 1 {
+		t.Errorf("expected %v, got %v", 1, s.SessionCount())
+	}
+
+	l2.Release()
+	if s.SessionCount() != 0 {
+		t.Errorf("expected %v, got %v", 0, s.SessionCount())
+	}
+}
+
+func TestLeaseFallingBehindDoesNotBlockOthers(t *testing.T) {
+	s := fakeserver.New()
+	p := New(client.DecodeErrorPolicyNullField)
+	p.newClient = func(serverUrl url.URL, authorizationHeader *string) *client.EspWsClient {
+		c := client.New(serverUrl, authorizationHeader)
+		c.Transport = s.Transport()
+		return c
+	}
+	serverUrl := parseUrl(t, "ws://esp/connect")
+
+	stalled := p.Acquire(serverUrl, nil)
+	defer stalled.Release()
+	l := p.Acquire(serverUrl, nil)
+	defer l.Release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	sub, err := l.Subscribe("project", "cq", "window", 0, 0, nil, "", false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	err = s.WaitForSubscription(ctx, sub.Id())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	projectCount := 2 * leaseEventBufferSize
+	for i := 0; i < projectCount; i++ {
+		err = s.SendProjectLoaded("project")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	for received := 0; received < projectCount; {
+		select {
+		case event := <-l.Events():
+			if _, ok := event.(client.ProjectLoaded); ok {
+				received++
+			}
+		case <-ctx.Done():
+			t.Fatalf("expected %v events, got %v", projectCount, received)
+		}
+	}
+}
@@ -8,7 +8,6 @@ package windowevent
 import (
 	"fmt"
 	"grafana-esp-plugin/internal/esp/field"
-	"reflect"
 	"strconv"
 	"time"
 )
@@ -29,29 +28,43 @@ func New(eventTime time.Time, opcode string, fields []field.Field) WindowEvent {
 	return windowEvent
 }
 
+// KeyFields returns the fields of the event that identify it within its window.
+func (windowEvent WindowEvent) KeyFields() []field.Field {
+	keyFields := make([]field.Field, 0)
+	for _, f := range windowEvent.Fields {
+		if f.IsKey() {
+			keyFields = append(keyFields, f)
+		}
+	}
+
+	return keyFields
+}
+
 func (windowEvent WindowEvent) String() string {
 	return fmt.Sprintf("WindowEvent{time=%s, opcode=%s, fields=%s}", windowEvent.Time, windowEvent.Opcode, windowEvent.Fields)
 }
 
 func ParseWindowEventTime(timestamp any) (*time.Time, error) {
-	switch reflect.TypeOf(timestamp).Kind() {
-	case reflect.String:
-		var err error
-		timestamp, err = strconv.Atoi(timestamp.(string))
+	var microseconds int64
+	switch t := timestamp.(type) {
+	case string:
+		parsed, err := strconv.ParseInt(t, 10, 64)
 		if err != nil {
 			return nil, err
 		}
-		fallthrough
-	case reflect.Int:
-		timestamp = int64(timestamp.(int))
-	case reflect.Uint64:
-		timestamp = int64(timestamp.(uint64))
+		microseconds = parsed
+	case int:
+		microseconds = int64(t)
+	case int64:
+		microseconds = t
+	case uint64:
+		microseconds = int64(t)
 	default:
 		err := fmt.Errorf("invalid argument type %T", timestamp)
 		return nil, err
 	}
 
-	eventTime := time.UnixMicro(timestamp.(int64))
+	eventTime := time.UnixMicro(microseconds)
 
 	return &eventTime, nil
 }
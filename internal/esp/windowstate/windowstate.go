@@ -0,0 +1,184 @@
+/*
+	Copyright © 2023, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+	SPDX-License-Identifier: Apache-2.0
+*/
+
+// Package windowstate materializes the contents of an ESP window from the events of a subscription.
+package windowstate
+
+import (
+	"container/list"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"grafana-esp-plugin/internal/esp/field"
+	"grafana-esp-plugin/internal/esp/windowevent"
+)
+
+const (
+	OpcodeInsert     = "insert"
+	OpcodeUpdate     = "update"
+	OpcodeUpsert     = "upsert"
+	OpcodeDelete     = "delete"
+	OpcodeSafeDelete = "safedelete"
+)
+
+// WindowState holds the current rows of a window, keyed by the values of the key fields of the window schema. Rows
+// are kept in the order in which they were first inserted. Events of windows without key fields are all treated as
+// inserts. The oldest rows are evicted once the number of rows exceeds the maximum, unless the maximum is zero, after
+// which the state no longer holds all rows of the window.
+type WindowState struct {
+	maxRows int
+	evicted uint64
+	rows    *list.List
+	index   map[string]*list.Element
+	schema  *field.Schema
+}
+
+type row struct {
+	key   string
+	event windowevent.WindowEvent
+}
+
+func New(maxRows int) *WindowState {
+	return &WindowState{
+		maxRows: maxRows,
+		rows:    list.New(),
+		index:   make(map[string]*list.Element),
+	}
+}
+
+// SetSchema sets the schema of the window. The state is cleared if the schema differs from the previous one, as
+// the keys of existing rows may no longer apply.
+func (s *WindowState) SetSchema(schema *field.Schema) {
+	if s.schema != nil && !s.schema.Equal(schema) {
+		s.Reset()
+	}
+
+	s.schema = schema
+}
+
+// Reset removes all rows.
+func (s *WindowState) Reset() {
+	s.rows.Init()
+	clear(s.index)
+	s.evicted = 0
+}
+
+func (s *WindowState) Len() int {
+	return s.rows.Len()
+}
+
+func (s *WindowState) MaxRows() int {
+	return s.maxRows
+}
+
+// Evicted returns the number of rows evicted since the state was created or last reset.
+func (s *WindowState) Evicted() uint64 {
+	return s.evicted
+}
+
+// Apply applies a window event according to its opcode. Inserts replace the row with the same key, updates and
+// upserts merge the fields of the event into it, and deletes remove it.
+func (s *WindowState) Apply(event windowevent.WindowEvent) {
+	keyFields := event.KeyFields()
+	if len(keyFields) == 0 {
+		if !isDelete(event.Opcode) {
+			s.rows.PushBack(&row{event: event})
+			s.evict()
+		}
+		return
+	}
+
+	key := rowKey(keyFields)
+	element, exists := s.index[key]
+
+	switch {
+	case isDelete(event.Opcode):
+		if exists {
+			s.rows.Remove(element)
+			delete(s.index, key)
+		}
+	case !exists:
+		s.index[key] = s.rows.PushBack(&row{key: key, event: event})
+		s.evict()
+	case event.Opcode == OpcodeUpdate || event.Opcode == OpcodeUpsert:
+		r := element.Value.(*row)
+		r.event = mergeEvents(r.event, event)
+	default:
+		element.Value.(*row).event = event
+	}
+}
+
+// Rows returns the current rows of the window.
+func (s *WindowState) Rows() []windowevent.WindowEvent {
+	events := make([]windowevent.WindowEvent, 0, s.rows.Len())
+	for element := s.rows.Front(); element != nil; element = element.Next() {
+		events = append(events, element.Value.(*row).event)
+	}
+
+	return events
+}
+
+func (s *WindowState) evict() {
+	for s.maxRows > 0 && s.rows.Len() > s.maxRows {
+		oldest := s.rows.Remove(s.rows.Front()).(*row)
+		if oldest.key != "" {
+			delete(s.index, oldest.key)
+		}
+		s.evicted++
+	}
+}
+
+func isDelete(opcode string) bool {
+	return opcode == OpcodeDelete || opcode == OpcodeSafeDelete
+}
+
+// mergeEvents overlays the fields of an update on the fields of the existing event, as updates may carry only some
+// of the fields.
+func mergeEvents(existing windowevent.WindowEvent, update windowevent.WindowEvent) windowevent.WindowEvent {
+	updatedValues := make(map[string]field.Field, len(update.Fields))
+	for _, f := range update.Fields {
+		updatedValues[f.Name] = f
+	}
+
+	fields := make([]field.Field, 0, len(existing.Fields)+len(update.Fields))
+	for _, f := range existing.Fields {
+		if updated, ok := updatedValues[f.Name]; ok {
+			fields = append(fields, updated)
+			delete(updatedValues, f.Name)
+			continue
+		}
+
+		fields = append(fields, f)
+	}
+	for _, f := range update.Fields {
+		if _, ok := updatedValues[f.Name]; ok {
+			fields = append(fields, f)
+		}
+	}
+
+	return windowevent.New(update.Time, update.Opcode, fields)
+}
+
+func rowKey(keyFields []field.Field) string {
+	keyValues := make([]string, 0, len(keyFields))
+	for _, f := range keyFields {
+		keyValues = append(keyValues, keyValue(f.Value))
+	}
+
+	return strings.Join(keyValues, "\x00")
+}
+
+func keyValue(value any) string {
+	v := reflect.ValueOf(value)
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return "\x01null"
+		}
+		value = v.Elem().Interface()
+	}
+
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,146 @@
+/*
+	Copyright © 2023, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+	SPDX-License-Identifier: Apache-2.0
+*/
+
+package windowstate
+
+import (
+	"testing"
+	"time"
+
+	"grafana-esp-plugin/internal/esp/field"
+	"grafana-esp-plugin/internal/esp/windowevent"
+)
+
+var (
+	idSchemaField    = &field.SchemaField{Name: "id", Type: field.Int64, TypeName: "int64", Precision: -1, Key: true}
+	valueSchemaField = &field.SchemaField{Name: "value", Type: field.Double, TypeName: "double", Precision: -1}
+	noteSchemaField  = &field.SchemaField{Name: "note", Type: field.String, TypeName: "string", Precision: -1}
+)
+
+func newEvent(opcode string, id int64, fields ...field.Field) windowevent.WindowEvent {
+	eventFields := append([]field.Field{field.FromSchema(idSchemaField, id)}, fields...)
+	return windowevent.New(time.UnixMicro(id), opcode, eventFields)
+}
+
+func fieldValue(event windowevent.WindowEvent, name string) any {
+	for _, f := range event.Fields {
+		if f.Name == name {
+			return f.Value
+		}
+	}
+
+	return nil
+}
+
+func TestApplyOpcodes(t *testing.T) {
+	state := New(0)
+	state.Apply(newEvent(OpcodeInsert, 1, field.FromSchema(valueSchemaField, 1.0), field.FromSchema(noteSchemaField, "a")))
+	state.Apply(newEvent(OpcodeInsert, 2, field.FromSchema(valueSchemaField, 2.0)))
+	state.Apply(newEvent(OpcodeUpsert, 3, field.FromSchema(valueSchemaField, 3.0)))
+	state.Apply(newEvent(OpcodeUpdate, 1, field.FromSchema(valueSchemaField, 1.5)))
+	state.Apply(newEvent(OpcodeDelete, 2))
+
+	rows := state.Rows()
+	if len(rows) != 2 {
+		t.Fatalf("expected %v rows, got %v", 2, len(rows))
+	}
+
+	if fieldValue(rows[0], "id") != int64(1) || fieldValue(rows[1], "id") != int64(3) {
+		t.Errorf("expected rows 1 and 3, got %v", rows)
+	}
+	if fieldValue(rows[0], "value") != 1.5 {
+		t.Errorf("expected %v, got %v", 1.5, fieldValue(rows[0], "value"))
+	}
+	if fieldValue(rows[0], "note") != "a" {
+		t.Errorf("expected %v, got %v", "a", fieldValue(rows[0], "note"))
+	}
+}
+
+func TestApplyInsertReplacesRow(t *testing.T) {
+	state := New(0)
+	state.Apply(newEvent(OpcodeInsert, 1, field.FromSchema(valueSchemaField, 1.0), field.FromSchema(noteSchemaField, "a")))
+	state.Apply(newEvent(OpcodeInsert, 1, field.FromSchema(valueSchemaField, 2.0)))
+
+	rows := state.Rows()
+	if len(rows) != 1 {
+		t.Fatalf("expected %v rows, got %v", 1, len(rows))
+	}
+	if fieldValue(rows[0], "note") != nil {
+		t.Errorf("expected nil, got %v", fieldValue(rows[0], "note"))
+	}
+}
+
+func TestApplyDeleteOfMissingRow(t *testing.T) {
+	state := New(0)
+	state.Apply(newEvent(OpcodeSafeDelete, 1))
+
+	if state.Len() != 0 {
+		t.Errorf("expected %v rows, got %v", 0, state.Len())
+	}
+}
+
+func TestApplyNullKey(t *testing.T) {
+	state := New(0)
+	nullKey := windowevent.New(time.UnixMicro(0), OpcodeInsert, []field.Field{field.FromSchema(idSchemaField, (*int64)(nil))})
+	state.Apply(nullKey)
+	state.Apply(nullKey)
+	state.Apply(newEvent(OpcodeInsert, 0))
+
+	if state.Len() != 2 {
+		t.Errorf("expected %v rows, got %v", 2, state.Len())
+	}
+}
+
+func TestApplyWithoutKeyFields(t *testing.T) {
+	state := New(0)
+	event := windowevent.New(time.UnixMicro(0), OpcodeUpdate, []field.Field{field.New("value", 1.0)})
+	state.Apply(event)
+	state.Apply(event)
+	state.Apply(windowevent.New(time.UnixMicro(0), OpcodeDelete, []field.Field{field.New("value", 1.0)}))
+
+	if state.Len() != 2 {
+		t.Errorf("expected %v rows, got %v", 2, state.Len())
+	}
+}
+
+func TestApplyEvictsOldestRows(t *testing.T) {
+	state := New(2)
+	state.Apply(newEvent(OpcodeInsert, 1))
+	state.Apply(newEvent(OpcodeInsert, 2))
+	state.Apply(newEvent(OpcodeInsert, 3))
+	state.Apply(newEvent(OpcodeInsert, 1))
+
+	rows := state.Rows()
+	if len(rows) != 2 {
+		t.Fatalf("expected %v rows, got %v", 2, len(rows))
+	}
+	if fieldValue(rows[0], "id") != int64(3) || fieldValue(rows[1], "id") != int64(1) {
+		t.Errorf("expected rows 3 and 1, got %v", rows)
+	}
+	if state.Evicted() != 2 {
+		t.Errorf("expected %v evicted rows, got %v", 2, state.Evicted())
+	}
+
+	state.Reset()
+	if state.Evicted() != 0 {
+		t.Errorf("expected %v evicted rows, got %v", 0, state.Evicted())
+	}
+}
+
+func TestSetSchema(t *testing.T) {
+	state := New(0)
+	state.SetSchema(field.NewSchema([]*field.SchemaField{idSchemaField, valueSchemaField}))
+	state.Apply(newEvent(OpcodeInsert, 1))
+
+	state.SetSchema(field.NewSchema([]*field.SchemaField{idSchemaField, valueSchemaField}))
+	if state.Len() != 1 {
+		t.Errorf("expected %v rows, got %v", 1, state.Len())
+	}
+
+	state.SetSchema(field.NewSchema([]*field.SchemaField{idSchemaField, noteSchemaField}))
+	if state.Len() != 0 {
+		t.Errorf("expected %v rows, got %v", 0, state.Len())
+	}
+}
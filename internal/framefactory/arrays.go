@@ -0,0 +1,104 @@
+/*
+	Copyright © 2023, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+	SPDX-License-Identifier: Apache-2.0
+*/
+
+package framefactory
+
+import (
+	"fmt"
+	espfield "grafana-esp-plugin/internal/esp/field"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// ArrayLayout controls how the values of ESP array fields are laid out in frames.
+type ArrayLayout string
+
+const (
+	// ArrayLayoutJson holds each array as JSON in a single column.
+	ArrayLayoutJson ArrayLayout = ""
+	// ArrayLayoutColumns expands arrays into one numeric column per index, named field[0], field[1], and so on.
+	ArrayLayoutColumns ArrayLayout = "columns"
+	// ArrayLayoutRows explodes arrays into one row per element, repeating the other fields of the event.
+	ArrayLayoutRows ArrayLayout = "rows"
+)
+
+// IndexFieldName is the name of the column holding the index of the array elements of a row for ArrayLayoutRows.
+const IndexFieldName = "@index"
+
+func ParseArrayLayout(arrayLayout string) (ArrayLayout, error) {
+	switch strings.ToLower(arrayLayout) {
+	case "", "json":
+		return ArrayLayoutJson, nil
+	case string(ArrayLayoutColumns):
+		return ArrayLayoutColumns, nil
+	case string(ArrayLayoutRows):
+		return ArrayLayoutRows, nil
+	default:
+		return "", fmt.Errorf("unsupported array layout: %s", arrayLayout)
+	}
+}
+
+// arrayLength returns the length of an array field value, and whether the value is an array.
+func arrayLength(value any) (int, bool) {
+	switch array := value.(type) {
+	case []*float64:
+		return len(array), true
+	case []*int32:
+		return len(array), true
+	case []*int64:
+		return len(array), true
+	default:
+		return 0, false
+	}
+}
+
+// arrayElement returns the element of an array field value at the given index.
+func arrayElement(array any, index int) any {
+	switch array := array.(type) {
+	case []*float64:
+		return array[index]
+	case []*int32:
+		return array[index]
+	case []*int64:
+		return array[index]
+	default:
+		return nil
+	}
+}
+
+// arrayElementFieldType returns the nullable type of the frame field holding elements of an array field value.
+func arrayElementFieldType(array any) data.FieldType {
+	switch array.(type) {
+	case []*float64:
+		return data.FieldTypeNullableFloat64
+	case []*int32:
+		return data.FieldTypeNullableInt32
+	case []*int64:
+		return data.FieldTypeNullableInt64
+	default:
+		return data.FieldTypeUnknown
+	}
+}
+
+// schemaElementFieldType returns the nullable type of the frame field holding elements of values of an ESP array type.
+func schemaElementFieldType(schemaType espfield.SchemaType) data.FieldType {
+	switch schemaType {
+	case espfield.ArrayDouble:
+		return data.FieldTypeNullableFloat64
+	case espfield.ArrayInt32:
+		return data.FieldTypeNullableInt32
+	case espfield.ArrayInt64:
+		return data.FieldTypeNullableInt64
+	default:
+		return data.FieldTypeUnknown
+	}
+}
+
+// arrayColumnName returns the name of the column holding the elements of an array field at the given index for
+// ArrayLayoutColumns.
+func arrayColumnName(fieldName string, index int) string {
+	return fmt.Sprintf("%s[%d]", fieldName, index)
+}
@@ -8,93 +8,308 @@ package framefactory
 import (
 	"encoding/json"
 	"fmt"
-	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	espfield "grafana-esp-plugin/internal/esp/field"
 	"grafana-esp-plugin/internal/esp/windowevent"
+	"reflect"
 	"time"
 
 	"github.com/grafana/grafana-plugin-sdk-go/data"
 )
 
-const OpcodeFieldName = "@opcode"
+const (
+	TimestampFieldName = "@timestamp"
+	OpcodeFieldName    = "@opcode"
+)
+
+// KeyConfigName is the name of the custom field config property set on frame fields holding ESP key fields.
+const KeyConfigName = "espKey"
+
+// FrameOptions controls the layout of window event frames. TimeField names a schema field of type stamp or date that
+// is placed first, so that it is used as the time field of the frame. OmitEventTimestamp leaves out the column of
+// the timestamps assigned to events by the ESP server. ArrayLayout controls how array fields are laid out.
+type FrameOptions struct {
+	TimeField          string
+	OmitEventTimestamp bool
+	ArrayLayout        ArrayLayout
+}
+
+// NewWindowEventsFrame returns a frame holding one row per window event. If a schema is given, the frame has a column
+// for every field of the schema, in schema order, followed by columns for event fields that are not part of it.
+// Columns of event fields are nullable, so that rows lacking a field hold null. An error is returned if a field value
+// is of a type that frames cannot hold, if the values of a field differ in type between events, or if the time field
+// of the options is not a timestamp or date field of the schema.
+//
+// With ArrayLayoutColumns, array fields are expanded into as many columns as the longest array of the events has
+// elements. With ArrayLayoutRows, every event has as many rows as its longest array has elements, numbered by an
+// IndexFieldName column, and the other fields of the event are repeated on each of them.
+func NewWindowEventsFrame(schema *espfield.Schema, windowEvents []windowevent.WindowEvent, options FrameOptions) (*data.Frame, error) {
+	// eventRows holds the first row of every event, followed by the row count of the frame.
+	eventRows := make([]int, len(windowEvents)+1)
+	arrayLengths := make(map[string]int)
+	for i, windowEvent := range windowEvents {
+		eventRowCount := 1
+		for _, field := range windowEvent.Fields {
+			if length, ok := arrayLength(field.Value); ok {
+				arrayLengths[field.Name] = max(arrayLengths[field.Name], length)
+				if options.ArrayLayout == ArrayLayoutRows {
+					eventRowCount = max(eventRowCount, length)
+				}
+			}
+		}
+		eventRows[i+1] = eventRows[i] + eventRowCount
+	}
+
+	rowCount := eventRows[len(windowEvents)]
+	timestamps := data.NewFieldFromFieldType(data.FieldTypeTime, rowCount)
+	timestamps.Name = TimestampFieldName
+	opcodes := data.NewFieldFromFieldType(data.FieldTypeString, rowCount)
+	opcodes.Name = OpcodeFieldName
 
-func NewWindowEventFrame(windowEvent windowevent.WindowEvent) *data.Frame {
 	frame := data.NewFrame("response")
-	frame = populateFrameWithField(frame, "@timestamp", windowEvent.Time)
-	frame = populateFrameWithField(frame, OpcodeFieldName, windowEvent.Opcode)
-
-	for _, field := range windowEvent.Fields {
-		fieldName := field.Name
-		fieldValue := field.Value
-
-		switch fieldValue.(type) {
-		case int8:
-			populateFrameWithField(frame, fieldName, fieldValue.(int8))
-		case *int8:
-			populateFrameWithField(frame, fieldName, fieldValue.(*int8))
-		case int16:
-			populateFrameWithField(frame, fieldName, fieldValue.(int16))
-		case *int16:
-			populateFrameWithField(frame, fieldName, fieldValue.(*int16))
-		case int32:
-			populateFrameWithField(frame, fieldName, fieldValue.(int32))
-		case *int32:
-			populateFrameWithField(frame, fieldName, fieldValue.(*int32))
-		case int64:
-			populateFrameWithField(frame, fieldName, fieldValue.(int64))
-		case *int64:
-			populateFrameWithField(frame, fieldName, fieldValue.(*int64))
-		case uint8:
-			populateFrameWithField(frame, fieldName, fieldValue.(uint8))
-		case *uint8:
-			populateFrameWithField(frame, fieldName, fieldValue.(*uint8))
-		case uint16:
-			populateFrameWithField(frame, fieldName, fieldValue.(uint16))
-		case *uint16:
-			populateFrameWithField(frame, fieldName, fieldValue.(*uint16))
-		case uint32:
-			populateFrameWithField(frame, fieldName, fieldValue.(uint32))
-		case *uint32:
-			populateFrameWithField(frame, fieldName, fieldValue.(*uint32))
-		case uint64:
-			populateFrameWithField(frame, fieldName, fieldValue.(uint64))
-		case *uint64:
-			populateFrameWithField(frame, fieldName, fieldValue.(*uint64))
-		case float32:
-			populateFrameWithField(frame, fieldName, fieldValue.(float32))
-		case *float32:
-			populateFrameWithField(frame, fieldName, fieldValue.(*float32))
-		case float64:
-			populateFrameWithField(frame, fieldName, fieldValue.(float64))
-		case *float64:
-			populateFrameWithField(frame, fieldName, fieldValue.(*float64))
-		case string:
-			populateFrameWithField(frame, fieldName, fieldValue.(string))
-		case *string:
-			populateFrameWithField(frame, fieldName, fieldValue.(*string))
-		case bool:
-			populateFrameWithField(frame, fieldName, fieldValue.(bool))
-		case *bool:
-			populateFrameWithField(frame, fieldName, fieldValue.(*bool))
-		case time.Time:
-			populateFrameWithField(frame, fieldName, fieldValue.(time.Time))
-		case *time.Time:
-			populateFrameWithField(frame, fieldName, fieldValue.(*time.Time))
-		case json.RawMessage:
-			populateFrameWithField(frame, fieldName, fieldValue.(json.RawMessage))
-		case *json.RawMessage:
-			populateFrameWithField(frame, fieldName, fieldValue.(*json.RawMessage))
-		case data.EnumItemIndex:
-			populateFrameWithField(frame, fieldName, fieldValue.(data.EnumItemIndex))
-		case *data.EnumItemIndex:
-			populateFrameWithField(frame, fieldName, fieldValue.(*data.EnumItemIndex))
-		default:
-			err := fmt.Errorf("field '%s' specified with unsupported type %T", fieldName, fieldValue)
-			log.DefaultLogger.Error(err.Error())
-			panic(err)
+	if options.TimeField != "" {
+		timeColumn, err := newTimeColumn(schema, options.TimeField, rowCount)
+		if err != nil {
+			return nil, err
 		}
+		frame.Fields = append(frame.Fields, timeColumn)
+	}
+	if !options.OmitEventTimestamp {
+		frame.Fields = append(frame.Fields, timestamps)
 	}
+	frame.Fields = append(frame.Fields, opcodes)
 
-	return frame
+	var indexes *data.Field
+	if options.ArrayLayout == ArrayLayoutRows {
+		indexes = data.NewFieldFromFieldType(data.FieldTypeInt64, rowCount)
+		indexes.Name = IndexFieldName
+		frame.Fields = append(frame.Fields, indexes)
+	}
+
+	columns := make(map[string]*data.Field)
+	arrayColumns := make(map[string][]*data.Field)
+	if options.TimeField != "" {
+		columns[options.TimeField] = frame.Fields[0]
+	}
+	if schema != nil {
+		for _, schemaField := range schema.Fields {
+			if _, ok := columns[schemaField.Name]; ok {
+				continue
+			}
+
+			if schemaField.Type.IsArray() && options.ArrayLayout == ArrayLayoutColumns {
+				arrayColumns[schemaField.Name] = newArrayColumns(schemaField.Name, schemaElementFieldType(schemaField.Type), schemaField, arrayLengths[schemaField.Name], rowCount)
+				frame.Fields = append(frame.Fields, arrayColumns[schemaField.Name]...)
+				continue
+			}
+
+			fieldType := frameFieldType(schemaField.Type)
+			if schemaField.Type.IsArray() && options.ArrayLayout == ArrayLayoutRows {
+				fieldType = schemaElementFieldType(schemaField.Type)
+			}
+
+			column := data.NewFieldFromFieldType(fieldType, rowCount)
+			column.Name = schemaField.Name
+			column.Config = newFieldConfig(schemaField)
+			columns[schemaField.Name] = column
+			frame.Fields = append(frame.Fields, column)
+		}
+	}
+
+	for i, windowEvent := range windowEvents {
+		firstRow, lastRow := eventRows[i], eventRows[i+1]
+		for row := firstRow; row < lastRow; row++ {
+			timestamps.Set(row, windowEvent.Time)
+			opcodes.Set(row, windowEvent.Opcode)
+			if indexes != nil {
+				indexes.Set(row, int64(row-firstRow))
+			}
+		}
+
+		for _, field := range windowEvent.Fields {
+			if length, ok := arrayLength(field.Value); ok && options.ArrayLayout != ArrayLayoutJson {
+				elementType := arrayElementFieldType(field.Value)
+
+				if options.ArrayLayout == ArrayLayoutColumns {
+					elementColumns, ok := arrayColumns[field.Name]
+					if !ok {
+						elementColumns = newArrayColumns(field.Name, elementType, field.Schema, arrayLengths[field.Name], rowCount)
+						arrayColumns[field.Name] = elementColumns
+						frame.Fields = append(frame.Fields, elementColumns...)
+					} else if len(elementColumns) > 0 && elementColumns[0].Type() != elementType {
+						return nil, fmt.Errorf("field '%s' specified with type %T, expected elements of type %s", field.Name, field.Value, elementColumns[0].Type())
+					}
+
+					for index := 0; index < length; index++ {
+						elementColumns[index].Set(i, arrayElement(field.Value, index))
+					}
+					continue
+				}
+
+				column, ok := columns[field.Name]
+				if !ok {
+					column = data.NewFieldFromFieldType(elementType, rowCount)
+					column.Name = field.Name
+					if field.Schema != nil {
+						column.Config = newFieldConfig(field.Schema)
+					}
+					columns[field.Name] = column
+					frame.Fields = append(frame.Fields, column)
+				} else if column.Type() != elementType {
+					return nil, fmt.Errorf("field '%s' specified with type %T, expected elements of type %s", field.Name, field.Value, column.Type())
+				}
+
+				for index := 0; index < length; index++ {
+					column.Set(firstRow+index, arrayElement(field.Value, index))
+				}
+				continue
+			}
+
+			fieldValue := field.Value
+			isImage := false
+			switch value := fieldValue.(type) {
+			case []*float64, []*int32, []*int64:
+				// Frames cannot hold arrays, so array fields are represented as JSON.
+				fieldValue = arrayToJson(fieldValue)
+			case espfield.BlobValue:
+				// Images are held as data URIs, so that Grafana can display them.
+				isImage = value.IsImage()
+				fieldValue = value.String()
+			}
+
+			fieldType := data.FieldTypeFor(fieldValue)
+			if fieldType == data.FieldTypeUnknown {
+				return nil, fmt.Errorf("field '%s' specified with unsupported type %T", field.Name, field.Value)
+			}
+
+			column, ok := columns[field.Name]
+			if !ok {
+				column = data.NewFieldFromFieldType(fieldType.NullableType(), rowCount)
+				column.Name = field.Name
+				if field.Schema != nil {
+					column.Config = newFieldConfig(field.Schema)
+				}
+				columns[field.Name] = column
+				frame.Fields = append(frame.Fields, column)
+			} else if column.Type() != fieldType.NullableType() {
+				return nil, fmt.Errorf("field '%s' specified with type %T, expected %s", field.Name, field.Value, column.Type())
+			}
+			if isImage {
+				setImageFieldConfig(column)
+			}
+
+			for row := firstRow; row < lastRow; row++ {
+				if fieldType.Nullable() {
+					column.Set(row, fieldValue)
+				} else {
+					column.SetConcrete(row, fieldValue)
+				}
+			}
+		}
+	}
+
+	return frame, nil
+}
+
+// newArrayColumns returns the columns holding the elements of an array field for ArrayLayoutColumns, one per index.
+func newArrayColumns(fieldName string, elementType data.FieldType, schemaField *espfield.SchemaField, length int, rowCount int) []*data.Field {
+	elementColumns := make([]*data.Field, length)
+	for index := range elementColumns {
+		elementColumns[index] = data.NewFieldFromFieldType(elementType, rowCount)
+		elementColumns[index].Name = arrayColumnName(fieldName, index)
+		if schemaField != nil {
+			elementColumns[index].Config = newFieldConfig(schemaField)
+		}
+	}
+
+	return elementColumns
+}
+
+// newTimeColumn returns the column of the time field of the schema of the given name.
+func newTimeColumn(schema *espfield.Schema, timeField string, rowCount int) (*data.Field, error) {
+	if schema == nil {
+		return nil, fmt.Errorf("time field '%s' specified without schema", timeField)
+	}
+
+	schemaField, ok := schema.Field(timeField)
+	if !ok {
+		return nil, fmt.Errorf("time field '%s' is not a field of the window", timeField)
+	}
+	if schemaField.Type != espfield.Timestamp && schemaField.Type != espfield.Date {
+		return nil, fmt.Errorf("time field '%s' is of type %s, expected %s or %s", timeField, schemaField.TypeName, espfield.Timestamp, espfield.Date)
+	}
+
+	column := data.NewFieldFromFieldType(frameFieldType(schemaField.Type), rowCount)
+	column.Name = schemaField.Name
+	column.Config = newFieldConfig(schemaField)
+
+	return column, nil
+}
+
+// frameFieldType returns the nullable type of the frame field holding values of an ESP schema type. Arrays are held as
+// JSON, and blobs and values of unknown types as strings.
+func frameFieldType(schemaType espfield.SchemaType) data.FieldType {
+	switch schemaType {
+	case espfield.Int32:
+		return data.FieldTypeNullableInt32
+	case espfield.Int64:
+		return data.FieldTypeNullableInt64
+	case espfield.Double, espfield.Money:
+		return data.FieldTypeNullableFloat64
+	case espfield.ArrayDouble, espfield.ArrayInt32, espfield.ArrayInt64:
+		return data.FieldTypeNullableJSON
+	case espfield.Timestamp, espfield.Date:
+		return data.FieldTypeNullableTime
+	default:
+		return data.FieldTypeNullableString
+	}
+}
+
+// newFieldConfig returns the configuration of a frame field derived from the schema of the ESP field. Key fields
+// are marked with the KeyConfigName custom property and are filterable.
+func newFieldConfig(schemaField *espfield.SchemaField) *data.FieldConfig {
+	var config *data.FieldConfig
+
+	if schemaField.Type == espfield.Money && schemaField.Precision >= 0 {
+		decimals := uint16(schemaField.Precision)
+		config = &data.FieldConfig{Decimals: &decimals}
+	}
+
+	if schemaField.Key {
+		if config == nil {
+			config = &data.FieldConfig{}
+		}
+		filterable := true
+		config.Filterable = &filterable
+		config.Custom = map[string]any{KeyConfigName: true}
+	}
+
+	return config
+}
+
+// setImageFieldConfig marks a frame field as holding images, so that tables display its values as images.
+func setImageFieldConfig(column *data.Field) {
+	if column.Config == nil {
+		column.Config = &data.FieldConfig{}
+	}
+	if column.Config.Custom == nil {
+		column.Config.Custom = make(map[string]any)
+	}
+	column.Config.Custom["cellOptions"] = map[string]any{"type": "image"}
+}
+
+// arrayToJson encodes an array field value as JSON. Nil arrays are represented as null.
+func arrayToJson(array any) *json.RawMessage {
+	if reflect.ValueOf(array).IsNil() {
+		return nil
+	}
+
+	arrayBytes, err := json.Marshal(array)
+	if err != nil {
+		return nil
+	}
+
+	rawMessage := json.RawMessage(arrayBytes)
+	return &rawMessage
 }
 
 func NewErrorFrame(errorMessage string) *data.Frame {
@@ -105,6 +320,14 @@ func NewErrorFrame(errorMessage string) *data.Frame {
 	return frame
 }
 
+func NewStatusFrame(statusMessage string) *data.Frame {
+	frame := data.NewFrame("status")
+	populateFrameWithField(frame, OpcodeFieldName, "status")
+	populateFrameWithField(frame, "@status", statusMessage)
+
+	return frame
+}
+
 func NewErrorClearFrame() *data.Frame {
 	frame := data.NewFrame("error-clear")
 	populateFrameWithField(frame, OpcodeFieldName, "error-clear")
@@ -0,0 +1,448 @@
+/*
+	Copyright © 2023, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+	SPDX-License-Identifier: Apache-2.0
+*/
+
+package framefactory
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"grafana-esp-plugin/internal/esp/field"
+	"grafana-esp-plugin/internal/esp/windowevent"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+var (
+	idSchemaField    = &field.SchemaField{Name: "id", Type: field.Int64, TypeName: "int64", Precision: -1, Key: true}
+	valueSchemaField = &field.SchemaField{Name: "value", Type: field.Double, TypeName: "double", Precision: -1}
+)
+
+func TestNewWindowEventsFrameFieldTypes(t *testing.T) {
+	one := 1.5
+	price := &field.SchemaField{Name: "price", Type: field.Money, TypeName: "money", Precision: 2}
+	event := windowevent.New(time.UnixMicro(0), "insert", []field.Field{
+		field.New("count", int32(3)),
+		field.New("values", []*float64{&one, nil}),
+		field.New("missing", []*int64(nil)),
+		field.FromSchema(price, 9.99),
+	})
+
+	frame, err := NewWindowEventsFrame(nil, []windowevent.WindowEvent{event}, FrameOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	countField, _ := frame.FieldByName("count")
+	if count, _ := countField.ConcreteAt(0); count != int32(3) {
+		t.Errorf("expected %v, got %v", int32(3), count)
+	}
+
+	valuesField, _ := frame.FieldByName("values")
+	values, ok := valuesField.At(0).(*json.RawMessage)
+	if !ok || values == nil || string(*values) != "[1.5,null]" {
+		t.Errorf("expected %v, got %v", "[1.5,null]", valuesField.At(0))
+	}
+
+	missingField, _ := frame.FieldByName("missing")
+	if missingField.At(0).(*json.RawMessage) != nil {
+		t.Errorf("expected nil, got %v", missingField.At(0))
+	}
+
+	priceField, _ := frame.FieldByName("price")
+	if priceField.Config == nil || priceField.Config.Decimals == nil || *priceField.Config.Decimals != 2 {
+		t.Errorf("expected %v decimals, got %v", 2, priceField.Config)
+	}
+}
+
+func TestNewWindowEventsFrameKeyFields(t *testing.T) {
+	event := windowevent.New(time.UnixMicro(0), "insert", []field.Field{
+		field.FromSchema(idSchemaField, int64(1)),
+		field.FromSchema(valueSchemaField, 0.5),
+	})
+
+	frame, err := NewWindowEventsFrame(nil, []windowevent.WindowEvent{event}, FrameOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	idField, _ := frame.FieldByName("id")
+	if idField.Config == nil || idField.Config.Custom[KeyConfigName] != true {
+		t.Errorf("expected key field config, got %v", idField.Config)
+	}
+
+	valueField, _ := frame.FieldByName("value")
+	if valueField.Config != nil {
+		t.Errorf("expected nil, got %v", valueField.Config)
+	}
+}
+
+func TestNewWindowEventsFrameRows(t *testing.T) {
+	nullValue := (*float64)(nil)
+	events := []windowevent.WindowEvent{
+		windowevent.New(time.UnixMicro(0), "insert", []field.Field{
+			field.FromSchema(idSchemaField, int64(1)),
+			field.FromSchema(valueSchemaField, 0.5),
+		}),
+		windowevent.New(time.UnixMicro(1), "update", []field.Field{
+			field.FromSchema(idSchemaField, int64(2)),
+		}),
+		windowevent.New(time.UnixMicro(2), "insert", []field.Field{
+			field.FromSchema(idSchemaField, int64(3)),
+			field.FromSchema(valueSchemaField, nullValue),
+		}),
+	}
+
+	frame, err := NewWindowEventsFrame(nil, events, FrameOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	rowCount, err := frame.RowLen()
+	if err != nil || rowCount != 3 {
+		t.Fatalf("expected %v rows, got %v (%v)", 3, rowCount, err)
+	}
+
+	opcodeField, _ := frame.FieldByName(OpcodeFieldName)
+	if opcodeField.At(1) != "update" {
+		t.Errorf("expected %v, got %v", "update", opcodeField.At(1))
+	}
+
+	timestampField, _ := frame.FieldByName(TimestampFieldName)
+	if timestampField.At(2) != time.UnixMicro(2) {
+		t.Errorf("expected %v, got %v", time.UnixMicro(2), timestampField.At(2))
+	}
+
+	idField, _ := frame.FieldByName("id")
+	if id, _ := idField.ConcreteAt(1); id != int64(2) {
+		t.Errorf("expected %v, got %v", int64(2), id)
+	}
+
+	valueField, _ := frame.FieldByName("value")
+	if value, _ := valueField.ConcreteAt(0); value != 0.5 {
+		t.Errorf("expected %v, got %v", 0.5, value)
+	}
+	for _, i := range []int{1, 2} {
+		if _, ok := valueField.ConcreteAt(i); ok {
+			t.Errorf("expected null, got %v", valueField.At(i))
+		}
+	}
+}
+
+func TestNewWindowEventsFrameSchemaLayout(t *testing.T) {
+	name := &field.SchemaField{Name: "name", Type: field.String, TypeName: "string", Precision: -1}
+	values := &field.SchemaField{Name: "values", Type: field.ArrayDouble, TypeName: "array(dbl)", Precision: -1}
+	schema := field.NewSchema([]*field.SchemaField{idSchemaField, valueSchemaField, name, values})
+	event := windowevent.New(time.UnixMicro(0), "insert", []field.Field{
+		field.FromSchema(idSchemaField, int64(1)),
+		field.FromSchema(name, "one"),
+		field.New("extra", true),
+	})
+
+	frame, err := NewWindowEventsFrame(schema, []windowevent.WindowEvent{event}, FrameOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expectedNames := []string{TimestampFieldName, OpcodeFieldName, "id", "value", "name", "values", "extra"}
+	if len(frame.Fields) != len(expectedNames) {
+		t.Fatalf("expected %v fields, got %v", len(expectedNames), len(frame.Fields))
+	}
+	for i, expectedName := range expectedNames {
+		if frame.Fields[i].Name != expectedName {
+			t.Errorf("expected %v, got %v", expectedName, frame.Fields[i].Name)
+		}
+	}
+
+	valueField, _ := frame.FieldByName("value")
+	if valueField.Type() != data.FieldTypeNullableFloat64 || valueField.At(0).(*float64) != nil {
+		t.Errorf("expected null %v, got %v %v", data.FieldTypeNullableFloat64, valueField.Type(), valueField.At(0))
+	}
+
+	valuesField, _ := frame.FieldByName("values")
+	if valuesField.Type() != data.FieldTypeNullableJSON {
+		t.Errorf("expected %v, got %v", data.FieldTypeNullableJSON, valuesField.Type())
+	}
+}
+
+func TestNewWindowEventsFrameArrayColumns(t *testing.T) {
+	one, two, three := 0.1, 0.2, 0.3
+	probabilities := &field.SchemaField{Name: "probabilities", Type: field.ArrayDouble, TypeName: "array(dbl)", Precision: -1}
+	schema := field.NewSchema([]*field.SchemaField{idSchemaField, probabilities})
+	events := []windowevent.WindowEvent{
+		windowevent.New(time.UnixMicro(0), "insert", []field.Field{
+			field.FromSchema(idSchemaField, int64(1)),
+			field.FromSchema(probabilities, []*float64{&one, &two}),
+		}),
+		windowevent.New(time.UnixMicro(1), "insert", []field.Field{
+			field.FromSchema(idSchemaField, int64(2)),
+			field.FromSchema(probabilities, []*float64{&three, nil, &one}),
+		}),
+	}
+
+	frame, err := NewWindowEventsFrame(schema, events, FrameOptions{ArrayLayout: ArrayLayoutColumns})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expectedNames := []string{TimestampFieldName, OpcodeFieldName, "id", "probabilities[0]", "probabilities[1]", "probabilities[2]"}
+	if len(frame.Fields) != len(expectedNames) {
+		t.Fatalf("expected %v fields, got %v", len(expectedNames), len(frame.Fields))
+	}
+	for i, expectedName := range expectedNames {
+		if frame.Fields[i].Name != expectedName {
+			t.Errorf("expected %v, got %v", expectedName, frame.Fields[i].Name)
+		}
+	}
+
+	last, _ := frame.FieldByName("probabilities[2]")
+	if last.Type() != data.FieldTypeNullableFloat64 {
+		t.Errorf("expected %v, got %v", data.FieldTypeNullableFloat64, last.Type())
+	}
+	if value, ok := last.ConcreteAt(0); ok {
+		t.Errorf("expected null, got %v", value)
+	}
+	if value, _ := last.ConcreteAt(1); value != one {
+		t.Errorf("expected %v, got %v", one, value)
+	}
+}
+
+func TestNewWindowEventsFrameArrayRows(t *testing.T) {
+	one, two := int32(1), int32(2)
+	events := []windowevent.WindowEvent{
+		windowevent.New(time.UnixMicro(0), "insert", []field.Field{
+			field.New("id", int64(1)),
+			field.New("boxes", []*int32{&one, &two}),
+		}),
+		windowevent.New(time.UnixMicro(1), "insert", []field.Field{
+			field.New("id", int64(2)),
+			field.New("boxes", []*int32{}),
+		}),
+	}
+
+	frame, err := NewWindowEventsFrame(nil, events, FrameOptions{ArrayLayout: ArrayLayoutRows})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if rowCount, _ := frame.RowLen(); rowCount != 3 {
+		t.Fatalf("expected %v rows, got %v", 3, rowCount)
+	}
+
+	expected := []struct {
+		index int64
+		id    int64
+		box   *int32
+	}{
+		{0, 1, &one},
+		{1, 1, &two},
+		{0, 2, nil},
+	}
+	indexes, _ := frame.FieldByName(IndexFieldName)
+	ids, _ := frame.FieldByName("id")
+	boxes, _ := frame.FieldByName("boxes")
+	for row, expectedRow := range expected {
+		if index := indexes.At(row); index != expectedRow.index {
+			t.Errorf("expected %v, got %v", expectedRow.index, index)
+		}
+		if id, _ := ids.ConcreteAt(row); id != expectedRow.id {
+			t.Errorf("expected %v, got %v", expectedRow.id, id)
+		}
+		if box := boxes.At(row).(*int32); box != expectedRow.box {
+			t.Errorf("expected %v, got %v", expectedRow.box, box)
+		}
+	}
+}
+
+func TestParseArrayLayout(t *testing.T) {
+	for input, expected := range map[string]ArrayLayout{"": ArrayLayoutJson, "json": ArrayLayoutJson, "Columns": ArrayLayoutColumns, "rows": ArrayLayoutRows} {
+		arrayLayout, err := ParseArrayLayout(input)
+		if err != nil || arrayLayout != expected {
+			t.Errorf("expected %v, got %v (%v)", expected, arrayLayout, err)
+		}
+	}
+
+	if _, err := ParseArrayLayout("matrix"); err == nil {
+		t.Errorf("expected error, got nil")
+	}
+}
+
+func TestNewWindowEventsFrameBlobs(t *testing.T) {
+	image := &field.SchemaField{Name: "image", Type: field.Blob, TypeName: "blob", Precision: -1}
+	schema := field.NewSchema([]*field.SchemaField{image})
+	events := []windowevent.WindowEvent{
+		windowevent.New(time.UnixMicro(0), "insert", []field.Field{
+			field.FromSchema(image, field.BlobValue{ContentType: "image/png", Data: []byte{1}}),
+		}),
+		windowevent.New(time.UnixMicro(1), "insert", []field.Field{
+			field.FromSchema(image, (*string)(nil)),
+		}),
+	}
+
+	frame, err := NewWindowEventsFrame(schema, events, FrameOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	imageField, _ := frame.FieldByName("image")
+	if value, _ := imageField.ConcreteAt(0); value != "data:image/png;base64,AQ==" {
+		t.Errorf("expected %v, got %v", "data:image/png;base64,AQ==", value)
+	}
+	if value, ok := imageField.ConcreteAt(1); ok {
+		t.Errorf("expected null, got %v", value)
+	}
+	if imageField.Config == nil || imageField.Config.Custom["cellOptions"] == nil {
+		t.Errorf("expected image cell options, got %v", imageField.Config)
+	}
+}
+
+func TestNewWindowEventsFrameSchemaOnly(t *testing.T) {
+	schema := field.NewSchema([]*field.SchemaField{idSchemaField, valueSchemaField})
+
+	frame, err := NewWindowEventsFrame(schema, nil, FrameOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(frame.Fields) != 4 {
+		t.Errorf("expected %v fields, got %v", 4, len(frame.Fields))
+	}
+}
+
+func TestNewWindowEventsFrameTimeField(t *testing.T) {
+	tradeTime := &field.SchemaField{Name: "tradeTime", Type: field.Timestamp, TypeName: "stamp", Precision: -1}
+	schema := field.NewSchema([]*field.SchemaField{idSchemaField, tradeTime})
+	event := windowevent.New(time.UnixMicro(0), "insert", []field.Field{
+		field.FromSchema(idSchemaField, int64(1)),
+		field.FromSchema(tradeTime, time.UnixMicro(5)),
+	})
+
+	testCases := []struct {
+		options       FrameOptions
+		expectedNames []string
+	}{
+		{FrameOptions{TimeField: "tradeTime"}, []string{"tradeTime", TimestampFieldName, OpcodeFieldName, "id"}},
+		{FrameOptions{TimeField: "tradeTime", OmitEventTimestamp: true}, []string{"tradeTime", OpcodeFieldName, "id"}},
+		{FrameOptions{OmitEventTimestamp: true}, []string{OpcodeFieldName, "id", "tradeTime"}},
+	}
+
+	for _, testCase := range testCases {
+		frame, err := NewWindowEventsFrame(schema, []windowevent.WindowEvent{event}, testCase.options)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if len(frame.Fields) != len(testCase.expectedNames) {
+			t.Fatalf("options %v: expected %v fields, got %v", testCase.options, len(testCase.expectedNames), len(frame.Fields))
+		}
+		for i, expectedName := range testCase.expectedNames {
+			if frame.Fields[i].Name != expectedName {
+				t.Errorf("options %v: expected %v, got %v", testCase.options, expectedName, frame.Fields[i].Name)
+			}
+		}
+
+		timeField, _ := frame.FieldByName("tradeTime")
+		if value, _ := timeField.ConcreteAt(0); value != time.UnixMicro(5) {
+			t.Errorf("options %v: expected %v, got %v", testCase.options, time.UnixMicro(5), value)
+		}
+	}
+}
+
+func TestNewWindowEventsFrameInvalidTimeField(t *testing.T) {
+	schema := field.NewSchema([]*field.SchemaField{idSchemaField})
+
+	for _, timeField := range []string{"id", "missing"} {
+		_, err := NewWindowEventsFrame(schema, nil, FrameOptions{TimeField: timeField})
+		if err == nil {
+			t.Errorf("time field %v: expected non-nil error", timeField)
+		}
+	}
+}
+
+func TestNewWindowEventsFrameEmpty(t *testing.T) {
+	frame, err := NewWindowEventsFrame(nil, nil, FrameOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	rowCount, _ := frame.RowLen()
+	if rowCount != 0 || len(frame.Fields) != 2 {
+		t.Errorf("expected empty frame, got %v rows and %v fields", rowCount, len(frame.Fields))
+	}
+}
+
+func TestNewWindowEventsFrameUnsupportedType(t *testing.T) {
+	event := windowevent.New(time.UnixMicro(0), "insert", []field.Field{field.New("bad", struct{}{})})
+
+	_, err := NewWindowEventsFrame(nil, []windowevent.WindowEvent{event}, FrameOptions{})
+	if err == nil {
+		t.Errorf("expected non-nil error")
+	}
+}
+
+func TestNewWindowEventsFrameMismatchedTypes(t *testing.T) {
+	events := []windowevent.WindowEvent{
+		windowevent.New(time.UnixMicro(0), "insert", []field.Field{field.New("value", int32(1))}),
+		windowevent.New(time.UnixMicro(1), "insert", []field.Field{field.New("value", "1")}),
+	}
+
+	_, err := NewWindowEventsFrame(nil, events, FrameOptions{})
+	if err == nil {
+		t.Errorf("expected non-nil error")
+	}
+}
+
+var benchmarkSchema = field.NewSchema([]*field.SchemaField{idSchemaField, valueSchemaField})
+
+func benchmarkEvents(count int) []windowevent.WindowEvent {
+	events := make([]windowevent.WindowEvent, 0, count)
+	for i := 0; i < count; i++ {
+		events = append(events, windowevent.New(time.UnixMicro(int64(i)), "insert", []field.Field{
+			field.FromSchema(idSchemaField, int64(i)),
+			field.FromSchema(valueSchemaField, float64(i)/2),
+			field.New("name", "event"),
+		}))
+	}
+
+	return events
+}
+
+// encodeFrame builds and encodes a frame of the events the way it is sent to Grafana Live.
+func encodeFrame(b *testing.B, events []windowevent.WindowEvent) {
+	frame, err := NewWindowEventsFrame(benchmarkSchema, events, FrameOptions{})
+	if err != nil {
+		b.Fatalf("Unexpected error: %v", err)
+	}
+
+	_, err = data.FrameToJSON(frame, data.IncludeAll)
+	if err != nil {
+		b.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+// BenchmarkFramePerEvent measures sending one frame per event, as done before events were batched.
+func BenchmarkFramePerEvent(b *testing.B) {
+	events := benchmarkEvents(1000)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		for i := range events {
+			encodeFrame(b, events[i:i+1])
+		}
+	}
+}
+
+// BenchmarkFramePerMessage measures sending a single frame for a message of events.
+func BenchmarkFramePerMessage(b *testing.B) {
+	events := benchmarkEvents(1000)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		encodeFrame(b, events)
+	}
+}
@@ -0,0 +1,149 @@
+/*
+	Copyright © 2023, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+	SPDX-License-Identifier: Apache-2.0
+*/
+
+package framefactory
+
+import (
+	"fmt"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// SeriesLayout splits the rows of window event frames into time series, one per distinct combination of values of
+// the series fields. The series seen so far are kept, so that successive frames of a stream hold the same fields
+// until a new series appears.
+type SeriesLayout struct {
+	seriesFields []string
+	series       []data.Labels
+	seriesIndex  map[string]int
+}
+
+func NewSeriesLayout(seriesFields []string) *SeriesLayout {
+	return &SeriesLayout{
+		seriesFields: seriesFields,
+		seriesIndex:  make(map[string]int),
+	}
+}
+
+// ToWideFrame converts a frame of window events into a wide time series frame. The first time field of the frame is
+// the time index, and every numeric field other than the series fields becomes one field per series, labelled with
+// the values of the series fields. Rows without time are left out. An error is returned if the frame has no time
+// field or lacks a series field.
+func (layout *SeriesLayout) ToWideFrame(frame *data.Frame) (*data.Frame, error) {
+	timeIndex := -1
+	for i, f := range frame.Fields {
+		if f.Type().Time() {
+			timeIndex = i
+			break
+		}
+	}
+	if timeIndex < 0 {
+		return nil, fmt.Errorf("time series require a time field")
+	}
+
+	seriesColumns := make([]*data.Field, 0, len(layout.seriesFields))
+	isSeriesField := make(map[string]bool, len(layout.seriesFields))
+	for _, seriesField := range layout.seriesFields {
+		column, _ := frame.FieldByName(seriesField)
+		if column == nil {
+			return nil, fmt.Errorf("series field '%s' is not a field of the window", seriesField)
+		}
+		seriesColumns = append(seriesColumns, column)
+		isSeriesField[seriesField] = true
+	}
+
+	valueColumns := make([]*data.Field, 0, len(frame.Fields))
+	for _, f := range frame.Fields {
+		if f.Type().Numeric() && !isSeriesField[f.Name] {
+			valueColumns = append(valueColumns, f)
+		}
+	}
+
+	rowCount, err := frame.RowLen()
+	if err != nil {
+		return nil, err
+	}
+
+	timeColumn := frame.Fields[timeIndex]
+	rows := make([]int, 0, rowCount)
+	rowSeries := make([]int, 0, rowCount)
+	for i := 0; i < rowCount; i++ {
+		if _, ok := timeColumn.ConcreteAt(i); !ok {
+			continue
+		}
+
+		rows = append(rows, i)
+		rowSeries = append(rowSeries, layout.seriesOf(seriesColumns, i))
+	}
+
+	times := data.NewFieldFromFieldType(data.FieldTypeTime, len(rows))
+	times.Name = timeColumn.Name
+	times.Config = timeColumn.Config
+	wideFrame := data.NewFrame(frame.Name, times)
+	wideFrame.Meta = &data.FrameMeta{Type: data.FrameTypeTimeSeriesWide, TypeVersion: data.FrameTypeVersion{0, 1}}
+
+	seriesFields := make([][]*data.Field, len(layout.series))
+	for s, labels := range layout.series {
+		for _, valueColumn := range valueColumns {
+			seriesField := data.NewFieldFromFieldType(valueColumn.Type().NullableType(), len(rows))
+			seriesField.Name = valueColumn.Name
+			seriesField.Labels = labels
+			seriesField.Config = newSeriesFieldConfig(valueColumn.Config)
+			seriesFields[s] = append(seriesFields[s], seriesField)
+			wideFrame.Fields = append(wideFrame.Fields, seriesField)
+		}
+	}
+
+	for wideRow, row := range rows {
+		value, _ := timeColumn.ConcreteAt(row)
+		times.Set(wideRow, value)
+
+		for v, valueColumn := range valueColumns {
+			if value, ok := valueColumn.ConcreteAt(row); ok {
+				seriesFields[rowSeries[wideRow]][v].SetConcrete(wideRow, value)
+			}
+		}
+	}
+
+	return wideFrame, nil
+}
+
+// seriesOf returns the index of the series of a row, registering the series if it has not been seen before.
+func (layout *SeriesLayout) seriesOf(seriesColumns []*data.Field, row int) int {
+	labels := make(data.Labels, len(seriesColumns))
+	for _, column := range seriesColumns {
+		labelValue := ""
+		if value, ok := column.ConcreteAt(row); ok {
+			labelValue = fmt.Sprint(value)
+		}
+		labels[column.Name] = labelValue
+	}
+
+	key := labels.String()
+	s, ok := layout.seriesIndex[key]
+	if !ok {
+		s = len(layout.series)
+		layout.series = append(layout.series, labels)
+		layout.seriesIndex[key] = s
+	}
+
+	return s
+}
+
+// newSeriesFieldConfig returns the configuration of a series field. Lines span the nulls of rows of other series.
+func newSeriesFieldConfig(config *data.FieldConfig) *data.FieldConfig {
+	seriesConfig := &data.FieldConfig{}
+	if config != nil {
+		*seriesConfig = *config
+	}
+
+	custom := map[string]any{"spanNulls": true}
+	for key, value := range seriesConfig.Custom {
+		custom[key] = value
+	}
+	seriesConfig.Custom = custom
+
+	return seriesConfig
+}
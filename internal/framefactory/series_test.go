@@ -0,0 +1,104 @@
+/*
+	Copyright © 2023, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+	SPDX-License-Identifier: Apache-2.0
+*/
+
+package framefactory
+
+import (
+	"testing"
+	"time"
+
+	"grafana-esp-plugin/internal/esp/field"
+	"grafana-esp-plugin/internal/esp/windowevent"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+var sensorSchemaField = &field.SchemaField{Name: "sensor", Type: field.String, TypeName: "string", Precision: -1, Key: true}
+
+func newSensorFrame(t *testing.T, readings ...any) *data.Frame {
+	schema := field.NewSchema([]*field.SchemaField{sensorSchemaField, valueSchemaField})
+	events := make([]windowevent.WindowEvent, 0, len(readings)/2)
+	for i := 0; i < len(readings); i += 2 {
+		events = append(events, windowevent.New(time.UnixMicro(int64(i)), "insert", []field.Field{
+			field.FromSchema(sensorSchemaField, readings[i]),
+			field.FromSchema(valueSchemaField, readings[i+1]),
+		}))
+	}
+
+	frame, err := NewWindowEventsFrame(schema, events, FrameOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	return frame
+}
+
+func TestSeriesLayoutToWideFrame(t *testing.T) {
+	layout := NewSeriesLayout([]string{"sensor"})
+
+	wideFrame, err := layout.ToWideFrame(newSensorFrame(t, "a", 1.0, "b", 2.0, "a", 3.0))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(wideFrame.Fields) != 3 || wideFrame.Fields[0].Name != TimestampFieldName {
+		t.Fatalf("expected time field and two series, got %v", wideFrame.Fields)
+	}
+	if wideFrame.Meta.Type != data.FrameTypeTimeSeriesWide {
+		t.Errorf("expected %v, got %v", data.FrameTypeTimeSeriesWide, wideFrame.Meta.Type)
+	}
+
+	seriesA := wideFrame.Fields[1]
+	if seriesA.Name != "value" || seriesA.Labels["sensor"] != "a" {
+		t.Errorf("expected value of sensor a, got %v %v", seriesA.Name, seriesA.Labels)
+	}
+	if value, _ := seriesA.ConcreteAt(2); value != 3.0 {
+		t.Errorf("expected %v, got %v", 3.0, value)
+	}
+	if _, ok := seriesA.ConcreteAt(1); ok {
+		t.Errorf("expected null, got %v", seriesA.At(1))
+	}
+	if seriesA.Config.Custom["spanNulls"] != true || seriesA.Config.Custom[KeyConfigName] != nil {
+		t.Errorf("unexpected config %v", seriesA.Config.Custom)
+	}
+
+	seriesB := wideFrame.Fields[2]
+	if value, _ := seriesB.ConcreteAt(1); seriesB.Labels["sensor"] != "b" || value != 2.0 {
+		t.Errorf("expected %v of sensor b, got %v %v", 2.0, value, seriesB.Labels)
+	}
+}
+
+func TestSeriesLayoutKeepsSeries(t *testing.T) {
+	layout := NewSeriesLayout([]string{"sensor"})
+
+	_, err := layout.ToWideFrame(newSensorFrame(t, "a", 1.0, "b", 2.0))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	wideFrame, err := layout.ToWideFrame(newSensorFrame(t, "b", 3.0))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(wideFrame.Fields) != 3 || wideFrame.Fields[1].Labels["sensor"] != "a" || wideFrame.Fields[2].Labels["sensor"] != "b" {
+		t.Errorf("expected series a and b, got %v", wideFrame.Fields)
+	}
+}
+
+func TestSeriesLayoutErrors(t *testing.T) {
+	frame := newSensorFrame(t, "a", 1.0)
+
+	_, err := NewSeriesLayout([]string{"missing"}).ToWideFrame(frame)
+	if err == nil {
+		t.Errorf("expected non-nil error")
+	}
+
+	frame.Fields = frame.Fields[1:]
+	_, err = NewSeriesLayout([]string{"sensor"}).ToWideFrame(frame)
+	if err == nil {
+		t.Errorf("expected non-nil error")
+	}
+}
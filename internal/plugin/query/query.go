@@ -11,7 +11,8 @@ import (
 	"fmt"
 	"net/url"
 	"strconv"
-	"strings"
+
+	"grafana-esp-plugin/internal/esp/client"
 )
 
 type Query struct {
@@ -23,9 +24,24 @@ type Query struct {
 	EventInterval       uint64
 	MaxEvents           uint64
 	AuthorizationHeader *string
+	Options
+}
+
+// Options are the optional settings of a query. Their zero values leave the events and frames of a query unchanged.
+type Options struct {
+	Format              string
+	Materialized        bool
+	TimeField           string
+	OmitEventTimestamp  bool
+	SeriesFields        []string
+	ArrayLayout         string
+	AggregationInterval uint64
+	Aggregations        []string
+	Filter              string
+	UserIdentity        string
 }
 
-func New(serverUrl url.URL, projectName string, cqName string, windowName string, interval uint64, maxEvents uint64, fields []string, authorizationHeader *string) *Query {
+func New(serverUrl url.URL, projectName string, cqName string, windowName string, interval uint64, maxEvents uint64, fields []string, options Options, authorizationHeader *string) *Query {
 	return &Query{
 		ServerUrl:           serverUrl,
 		ProjectName:         projectName,
@@ -35,6 +51,7 @@ func New(serverUrl url.URL, projectName string, cqName string, windowName string
 		MaxEvents:           maxEvents,
 		Fields:              fields,
 		AuthorizationHeader: authorizationHeader,
+		Options:             options,
 	}
 }
 
@@ -45,16 +62,55 @@ func (q *Query) ToChannelPath() string {
 }
 
 func (q *Query) calcHashString() string {
-	b := bytes.Join([][]byte{
-		[]byte(q.ServerUrl.String()),
-		[]byte(q.ProjectName),
-		[]byte(q.CqName),
-		[]byte(q.WindowName),
-		[]byte(strconv.Itoa(int(q.EventInterval))),
-		[]byte(strconv.Itoa(int(q.MaxEvents))),
-		[]byte(strings.Join(q.Fields, "/")),
-	}, []byte{0})
-	hashSum := sha256.Sum256(b)
+	// Every component is length-prefixed, so that no value can be crafted to make the hash input of one query equal
+	// to that of another, such as a query of another user.
+	var b bytes.Buffer
+	appendComponent := func(name string, values ...string) {
+		fmt.Fprintf(&b, "%s:%d", name, len(values))
+		for _, value := range values {
+			fmt.Fprintf(&b, ":%d:%s", len(value), value)
+		}
+		b.WriteByte(0)
+	}
+
+	appendComponent("serverUrl", q.ServerUrl.String())
+	appendComponent("projectName", q.ProjectName)
+	appendComponent("cqName", q.CqName)
+	appendComponent("windowName", q.WindowName)
+	appendComponent("interval", strconv.FormatUint(q.EventInterval, 10))
+	appendComponent("maxEvents", strconv.FormatUint(q.MaxEvents, 10))
+	appendComponent("fields", q.Fields...)
+	// Options are only hashed when they differ from their defaults.
+	if q.Format != "" && q.Format != client.CborFormat {
+		appendComponent("format", q.Format)
+	}
+	if q.Materialized {
+		appendComponent("materialized")
+	}
+	if q.TimeField != "" {
+		appendComponent("timeField", q.TimeField)
+	}
+	if q.OmitEventTimestamp {
+		appendComponent("omitEventTimestamp")
+	}
+	if len(q.SeriesFields) > 0 {
+		appendComponent("seriesFields", q.SeriesFields...)
+	}
+	if q.ArrayLayout != "" {
+		appendComponent("arrayLayout", q.ArrayLayout)
+	}
+	if q.AggregationInterval > 0 {
+		appendComponent("aggregationInterval", strconv.FormatUint(q.AggregationInterval, 10))
+		appendComponent("aggregations", q.Aggregations...)
+	}
+	if q.Filter != "" {
+		appendComponent("filter", q.Filter)
+	}
+	// Queries run with the credentials of a user are not shared with other users, as the credentials are not hashed.
+	if q.UserIdentity != "" {
+		appendComponent("user", q.UserIdentity)
+	}
+	hashSum := sha256.Sum256(b.Bytes())
 
 	return fmt.Sprintf("%x", hashSum)
 }
@@ -21,7 +21,7 @@ func createQuery(t *testing.T) Query {
 		t.Fatalf("Unexpected error: %v", err)
 	}
 
-	q := New(s.GetUrl(), "project", "cq", "window", 1, 2, []string{}, nil)
+	q := New(s.GetUrl(), "project", "cq", "window", 1, 2, []string{}, Options{Format: "cbor"}, nil)
 
 	return *q
 }
@@ -36,10 +36,44 @@ func TestQueryToChannelPath(t *testing.T) {
 	q3 := createQuery(t)
 	q3.ProjectName = "foo"
 
+	q4 := createQuery(t)
+	q4.Format = "json"
+
+	q5 := createQuery(t)
+	q5.Materialized = true
+
+	q6 := createQuery(t)
+	q6.TimeField = "tradeTime"
+	q6.OmitEventTimestamp = true
+
+	q7 := createQuery(t)
+	q7.SeriesFields = []string{"sensor"}
+
+	q8 := createQuery(t)
+	q8.ArrayLayout = "columns"
+
+	q9 := createQuery(t)
+	q9.AggregationInterval = 1000
+	q9.Aggregations = []string{"min", "max"}
+
+	q10 := createQuery(t)
+	q10.UserIdentity = "user"
+
+	q11 := createQuery(t)
+	q11.Filter = "severity = 'HIGH'"
+
 	equalityAssertions := []equalityAssertion{
-		{"stream/408e4ac72d899e96e5d777c2e9e74939a6257a15d2b365d55221763589b03c4e", q1.ToChannelPath()},
-		{"stream/408e4ac72d899e96e5d777c2e9e74939a6257a15d2b365d55221763589b03c4e", q2.ToChannelPath()},
-		{"stream/025b476e61af885aa2b86c50a37da4411d92ac1cc6a8956171145ccb9812aca8", q3.ToChannelPath()},
+		{"stream/dda94d0de168e5dcd543501e3066f9bccd31ede5182e4f5d4ac3fb859c6f7c06", q1.ToChannelPath()},
+		{"stream/dda94d0de168e5dcd543501e3066f9bccd31ede5182e4f5d4ac3fb859c6f7c06", q2.ToChannelPath()},
+		{"stream/d6bba2e729d1fe82fec8df1560afcd173686ad3561c53c9c8ca614fc5036683d", q3.ToChannelPath()},
+		{"stream/8a61b97915d260c38d35c4997fdd15eed4660d2096af44299f052a68a27d0a57", q4.ToChannelPath()},
+		{"stream/ba1171275f6d202e1fe9718d554c5277a733903a62ab0a1a9187a35b8a351211", q5.ToChannelPath()},
+		{"stream/35ef51ede4713394e78ccc3d94b533b5fdd948a53b51e961066aa0449999fc3e", q6.ToChannelPath()},
+		{"stream/cbf79c8f9d893e1889eef0b94c78c7de85e1f05fe259536ece1f4319f81c8cf4", q7.ToChannelPath()},
+		{"stream/22400647b649a795cef9ee8491f6db78891ef92b98e6c862899d60e8036c6582", q8.ToChannelPath()},
+		{"stream/cb1878e7dbca165e5938f778387077d467684531043dadc64809a1b7e95f1c98", q9.ToChannelPath()},
+		{"stream/b7eccceef67283b46530365fa7e03bca1598f5112f2b94278a2212f2b3e9e6e4", q10.ToChannelPath()},
+		{"stream/aca136a1b64e82146a07e3e3fa2ed0ba74b1acfc9a54ce31248f71640fe2e166", q11.ToChannelPath()},
 	}
 
 	for _, equalityAssertion := range equalityAssertions {
@@ -51,3 +85,25 @@ func TestQueryToChannelPath(t *testing.T) {
 		}
 	}
 }
+
+func TestQueryToChannelPathOfCraftedValues(t *testing.T) {
+	q1 := createQuery(t)
+	q1.Filter = "severity = 'HIGH'\x00user=alice"
+
+	q2 := createQuery(t)
+	q2.Filter = "severity = 'HIGH'"
+	q2.UserIdentity = "alice"
+
+	q3 := createQuery(t)
+	q3.Fields = []string{"a/b"}
+
+	q4 := createQuery(t)
+	q4.Fields = []string{"a", "b"}
+
+	if q1.ToChannelPath() == q2.ToChannelPath() {
+		t.Errorf("expected distinct channel paths, got %v", q1.ToChannelPath())
+	}
+	if q3.ToChannelPath() == q4.ToChannelPath() {
+		t.Errorf("expected distinct channel paths, got %v", q3.ToChannelPath())
+	}
+}
@@ -6,12 +6,21 @@
 package querydto
 
 type QueryDTO struct {
-	ExternalServerUrl string   `json:"externalServerUrl"`
-	InternalServerUrl string   `json:"internalServerUrl"`
-	ProjectName       string   `json:"projectName"`
-	CqName            string   `json:"cqName"`
-	WindowName        string   `json:"windowName"`
-	Fields            []string `json:"fields,omitempty"`
-	Interval          uint64   `json:"intervalMs,omitempty"`
-	MaxDataPoints     uint64   `json:"maxDataPoints,omitempty"`
+	ExternalServerUrl    string   `json:"externalServerUrl"`
+	InternalServerUrl    string   `json:"internalServerUrl"`
+	ProjectName          string   `json:"projectName"`
+	CqName               string   `json:"cqName"`
+	WindowName           string   `json:"windowName"`
+	Fields               []string `json:"fields,omitempty"`
+	Interval             uint64   `json:"intervalMs,omitempty"`
+	MaxDataPoints        uint64   `json:"maxDataPoints,omitempty"`
+	Format               string   `json:"format,omitempty"`
+	Materialized         bool     `json:"materialized,omitempty"`
+	TimeField            string   `json:"timeField,omitempty"`
+	OmitEventTimestamp   bool     `json:"omitEventTimestamp,omitempty"`
+	SeriesFields         []string `json:"seriesFields,omitempty"`
+	ArrayLayout          string   `json:"arrayLayout,omitempty"`
+	AggregationInterval  uint64   `json:"aggregationIntervalMs,omitempty"`
+	AggregationFunctions []string `json:"aggregationFunctions,omitempty"`
+	Filter               string   `json:"filter,omitempty"`
 }
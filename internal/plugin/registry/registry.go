@@ -0,0 +1,229 @@
+/*
+	Copyright © 2023, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+	SPDX-License-Identifier: Apache-2.0
+*/
+
+// Package registry provides a concurrent map whose entries expire, for values registered by one request and claimed
+// by a later one, such as the queries of stream channels.
+package registry
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	registryEntries = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "grafana_esp_plugin",
+		Name:      "registry_entries",
+		Help:      "Number of entries held by registries, by registry.",
+	}, []string{"registry"})
+	registryEvictionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "grafana_esp_plugin",
+		Name:      "registry_evictions_total",
+		Help:      "Number of registry entries evicted before being deleted, by registry and reason.",
+	}, []string{"registry", "reason"})
+)
+
+// Registry is a concurrent map of at most maxSize entries, which expire once they were set longer than ttl ago and are
+// evicted at least once every ttl.
+// Pinned entries, such as those in use, neither expire nor are evicted to make room for new entries; when the
+// registry is full, the least recently set entry that is not pinned is evicted, and new entries are rejected if all
+// entries are pinned.
+type Registry[K comparable, V any] struct {
+	name    string
+	ttl     time.Duration
+	maxSize int
+	now     func() time.Time
+	entries map[K]*entry[V]
+	lock    sync.RWMutex
+	done    chan struct{}
+	once    sync.Once
+}
+
+type entry[V any] struct {
+	value *V
+	set   time.Time
+	pins  int
+}
+
+// New returns an empty registry. The name labels the metrics of the registry. Registries whose entries expire must be
+// closed once no longer used.
+func New[K comparable, V any](name string, ttl time.Duration, maxSize int) *Registry[K, V] {
+	return newRegistry[K, V](name, ttl, maxSize, time.Now)
+}
+
+func newRegistry[K comparable, V any](name string, ttl time.Duration, maxSize int, now func() time.Time) *Registry[K, V] {
+	r := &Registry[K, V]{
+		name:    name,
+		ttl:     ttl,
+		maxSize: maxSize,
+		now:     now,
+		entries: make(map[K]*entry[V]),
+		done:    make(chan struct{}),
+	}
+	if ttl > 0 {
+		go r.evictPeriodically()
+	}
+
+	return r
+}
+
+// Close stops the eviction of expired entries and deletes all entries.
+func (r *Registry[K, V]) Close() {
+	r.once.Do(func() {
+		close(r.done)
+	})
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	registryEntries.WithLabelValues(r.name).Sub(float64(len(r.entries)))
+	r.entries = make(map[K]*entry[V])
+}
+
+// Set sets the value of a key, renewing its expiry. Expired entries are evicted, as is the least recently set entry
+// that is not pinned if the registry is full. An error is returned if the registry is full and all of its entries are
+// pinned. Setting nil deletes the key.
+func (r *Registry[K, V]) Set(key K, value *V) error {
+	if value == nil {
+		r.Delete(key)
+		return nil
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	now := r.now()
+	r.evictExpired(now)
+
+	if e, ok := r.entries[key]; ok {
+		e.value = value
+		e.set = now
+		return nil
+	}
+
+	if r.maxSize > 0 && len(r.entries) >= r.maxSize && !r.evictOldest() {
+		return fmt.Errorf("registry full: all %d entries are pinned", len(r.entries))
+	}
+
+	r.entries[key] = &entry[V]{value: value, set: now}
+	registryEntries.WithLabelValues(r.name).Inc()
+
+	return nil
+}
+
+// Get returns the value of a key, unless it is missing or expired.
+func (r *Registry[K, V]) Get(key K) (*V, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	e, ok := r.entries[key]
+	if !ok || r.isExpired(e, r.now()) {
+		return nil, fmt.Errorf("value not found for key: %v", key)
+	}
+
+	return e.value, nil
+}
+
+// Pin keeps the entry of a key from expiring and from being evicted until it is deleted or unpinned as many times as
+// it was pinned. An error is returned if the key is missing or expired.
+func (r *Registry[K, V]) Pin(key K) (*V, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	e, ok := r.entries[key]
+	if !ok || r.isExpired(e, r.now()) {
+		return nil, fmt.Errorf("value not found for key: %v", key)
+	}
+	e.pins++
+
+	return e.value, nil
+}
+
+// Unpin releases a pin of the entry of a key. Once no pins remain, the entry expires again, counting from now.
+func (r *Registry[K, V]) Unpin(key K) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if e, ok := r.entries[key]; ok && e.pins > 0 {
+		e.pins--
+		if e.pins == 0 {
+			e.set = r.now()
+		}
+	}
+}
+
+func (r *Registry[K, V]) Delete(key K) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if _, ok := r.entries[key]; ok {
+		delete(r.entries, key)
+		registryEntries.WithLabelValues(r.name).Dec()
+	}
+}
+
+// Len returns the number of entries, including expired entries that have not been evicted yet.
+func (r *Registry[K, V]) Len() int {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	return len(r.entries)
+}
+
+func (r *Registry[K, V]) isExpired(e *entry[V], now time.Time) bool {
+	return e.pins == 0 && r.ttl > 0 && now.Sub(e.set) >= r.ttl
+}
+
+func (r *Registry[K, V]) evictPeriodically() {
+	ticker := time.NewTicker(r.ttl)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			r.lock.Lock()
+			r.evictExpired(r.now())
+			r.lock.Unlock()
+		case <-r.done:
+			return
+		}
+	}
+}
+
+func (r *Registry[K, V]) evictExpired(now time.Time) {
+	for key, e := range r.entries {
+		if r.isExpired(e, now) {
+			r.evict(key, "expired")
+		}
+	}
+}
+
+func (r *Registry[K, V]) evictOldest() bool {
+	var oldestKey K
+	var oldest *entry[V]
+	for key, e := range r.entries {
+		if e.pins == 0 && (oldest == nil || e.set.Before(oldest.set)) {
+			oldestKey = key
+			oldest = e
+		}
+	}
+
+	if oldest == nil {
+		return false
+	}
+	r.evict(oldestKey, "full")
+
+	return true
+}
+
+func (r *Registry[K, V]) evict(key K, reason string) {
+	delete(r.entries, key)
+	registryEntries.WithLabelValues(r.name).Dec()
+	registryEvictionsTotal.WithLabelValues(r.name, reason).Inc()
+}
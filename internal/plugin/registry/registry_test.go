@@ -0,0 +1,153 @@
+/*
+	Copyright © 2023, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+	SPDX-License-Identifier: Apache-2.0
+*/
+
+package registry
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func newTestRegistry(ttl time.Duration, maxSize int) (*Registry[string, string], *time.Time) {
+	now := time.Now()
+	r := newRegistry[string, string]("test", ttl, maxSize, func() time.Time { return now })
+
+	return r, &now
+}
+
+func assertValue(t *testing.T, r *Registry[string, string], key string, expected string) {
+	value, err := r.Get(key)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *value != expected {
+		t.Errorf("expected %v, got %v", expected, *value)
+	}
+}
+
+func assertMissing(t *testing.T, r *Registry[string, string], key string) {
+	if value, err := r.Get(key); err == nil {
+		t.Errorf("expected non-nil error, got %v", *value)
+	}
+}
+
+func TestRegistryExpiresEntries(t *testing.T) {
+	r, now := newTestRegistry(time.Minute, 0)
+	value := "bar"
+
+	r.Set("foo", &value)
+	*now = now.Add(59 * time.Second)
+	assertValue(t, r, "foo", "bar")
+
+	*now = now.Add(time.Second)
+	assertMissing(t, r, "foo")
+
+	r.Set("other", &value)
+	if r.Len() != 1 {
+		t.Errorf("expected %v, got %v", 1, r.Len())
+	}
+}
+
+func TestRegistryEvictsOldestEntry(t *testing.T) {
+	r, now := newTestRegistry(0, 2)
+	a, b, c := "a", "b", "c"
+
+	r.Set("a", &a)
+	*now = now.Add(time.Second)
+	r.Set("b", &b)
+	*now = now.Add(time.Second)
+	r.Set("c", &c)
+
+	assertMissing(t, r, "a")
+	assertValue(t, r, "b", "b")
+	assertValue(t, r, "c", "c")
+}
+
+func TestRegistryKeepsPinnedEntries(t *testing.T) {
+	r, now := newTestRegistry(time.Minute, 1)
+	a, b := "a", "b"
+
+	r.Set("a", &a)
+	if _, err := r.Pin("a"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := r.Pin("a"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	*now = now.Add(time.Hour)
+	if err := r.Set("b", &b); err == nil {
+		t.Errorf("expected non-nil error")
+	}
+	assertValue(t, r, "a", "a")
+	assertMissing(t, r, "b")
+
+	r.Unpin("a")
+	*now = now.Add(time.Minute)
+	assertValue(t, r, "a", "a")
+
+	r.Unpin("a")
+	*now = now.Add(time.Minute)
+	assertMissing(t, r, "a")
+
+	if err := r.Set("b", &b); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertValue(t, r, "b", "b")
+
+	if _, err := r.Pin("missing"); err == nil {
+		t.Errorf("expected non-nil error")
+	}
+}
+
+func TestRegistryDelete(t *testing.T) {
+	r, _ := newTestRegistry(time.Minute, 0)
+	value := "bar"
+
+	r.Set("foo", &value)
+	r.Delete("foo")
+	assertMissing(t, r, "foo")
+
+	r.Set("foo", &value)
+	r.Set("foo", nil)
+	assertMissing(t, r, "foo")
+}
+
+func TestRegistryEvictsExpiredEntriesPeriodically(t *testing.T) {
+	r := New[string, string]("test", 10*time.Millisecond, 0)
+	t.Cleanup(r.Close)
+	value := "bar"
+
+	r.Set("foo", &value)
+	deadline := time.Now().Add(5 * time.Second)
+	for r.Len() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected expired entry to be evicted")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestRegistryClose(t *testing.T) {
+	r, _ := newTestRegistry(time.Minute, 0)
+	a, b := "a", "b"
+	gauge := registryEntries.WithLabelValues("test")
+
+	before := testutil.ToFloat64(gauge)
+	r.Set("a", &a)
+	r.Set("b", &b)
+	if value := testutil.ToFloat64(gauge); value != before+2 {
+		t.Errorf("expected %v, got %v", before+2, value)
+	}
+
+	r.Close()
+	if r.Len() != 0 {
+		t.Errorf("expected %v, got %v", 0, r.Len())
+	}
+	if value := testutil.ToFloat64(gauge); value != before {
+		t.Errorf("expected %v, got %v", before, value)
+	}
+}
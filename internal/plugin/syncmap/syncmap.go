@@ -40,7 +40,9 @@ func (s *SyncMap[K, V]) Set(key K, value *V) {
 }
 
 func (s *SyncMap[K, V]) Get(key K) (*V, error) {
+	s.lock.Lock()
 	value, found := s.syncMap[key]
+	s.lock.Unlock()
 	if !found {
 		return nil, fmt.Errorf("value not found for key: %v", key)
 	}
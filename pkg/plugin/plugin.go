@@ -7,6 +7,7 @@ package plugin
 
 import (
 	"context"
+	"crypto/sha256"
 	"encoding/json"
 	"encoding/xml"
 	"errors"
@@ -15,13 +16,19 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"slices"
 	"time"
 
+	"grafana-esp-plugin/internal/esp/aggregation"
 	"grafana-esp-plugin/internal/esp/client"
-	"grafana-esp-plugin/internal/esp/windowevent"
+	"grafana-esp-plugin/internal/esp/eventhistory"
+	"grafana-esp-plugin/internal/esp/filter"
+	"grafana-esp-plugin/internal/esp/pool"
+	"grafana-esp-plugin/internal/esp/windowstate"
 	"grafana-esp-plugin/internal/framefactory"
 	"grafana-esp-plugin/internal/plugin/query"
 	"grafana-esp-plugin/internal/plugin/querydto"
+	"grafana-esp-plugin/internal/plugin/registry"
 	"grafana-esp-plugin/internal/plugin/server"
 
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
@@ -72,32 +79,76 @@ func NewSampleDatasource(ctx context.Context, settings backend.DataSourceInstanc
 		return nil, err
 	}
 
+	decodeErrorPolicy, err := client.ParseDecodeErrorPolicy(jsonData.DecodeErrorPolicy)
+	if err != nil {
+		return nil, err
+	}
+
 	log.DefaultLogger.Debug(fmt.Sprintf("created data source with ForwardHTTPHeaders option set to: %v", opts.ForwardHTTPHeaders))
 
 	return &SampleDatasource{
 		httpClient:           cl,
 		url: *url,
 		jsonData:             jsonData,
-		channelQueryMap:      syncmap.New[string, query.Query](),
+		channelQueryMap:      registry.New[string, query.Query]("channel_queries", channelQueryTtl, channelQueryMaxCount),
+		channelBatcherMap:    syncmap.New[string, windowEventBatcher](),
+		connectionPool:       pool.New(decodeErrorPolicy),
 		serverUrlTrustedMap:  syncmap.New[string, bool](),
+		windowAccessMap:      registry.New[string, bool]("window_access", windowAccessTtl, windowAccessMaxCount),
 	}, nil
 }
 
 // SampleDatasource is an example datasource which can respond to data queries, reports
 // its health and has streaming skills.
 type SampleDatasource struct {
-	channelQueryMap      *syncmap.SyncMap[string, query.Query]
+	channelQueryMap      *registry.Registry[string, query.Query]
+	channelBatcherMap    *syncmap.SyncMap[string, windowEventBatcher]
+	connectionPool       *pool.Pool
 	httpClient           *http.Client
 	jsonData             datasourceJsonData
 	serverUrlTrustedMap  *syncmap.SyncMap[string, bool]
 	url                  url.URL
+	windowAccessMap      *registry.Registry[string, bool]
 }
 
+// windowStateMaxRows is the number of rows that materialized queries keep of a window, so that windows with an
+// unbounded number of keys cannot exhaust the memory of the plugin. The oldest rows are evicted beyond it, which is
+// logged and noted on the frames of the stream. The max data points of panels does not apply, as it limits the points
+// drawn rather than the rows of a window.
+const windowStateMaxRows = 100000
+
+// materializedFrameInterval is the minimum frame interval of materialized queries. As their frames hold all rows of
+// the window, sending one per events message would resend up to windowStateMaxRows rows for every event.
+const materializedFrameInterval = time.Second
+
+// historyMaxEvents caps the history size of the data source settings, so that the history of each stream cannot
+// exhaust the memory of the plugin.
+const historyMaxEvents = 100000
+
+// Queries are registered by QueryData for the stream channels that Grafana subscribes to next. Queries of channels
+// that are not subscribed to expire, and queries of running streams are kept until the stream ends.
+const (
+	channelQueryTtl      = 5 * time.Minute
+	channelQueryMaxCount = 10000
+)
+
+// Whether the forwarded OAuth token of a user can read a window is checked when the user subscribes to a stream, and
+// the outcome is reused by further subscriptions for a short while.
+const (
+	windowAccessTtl      = 30 * time.Second
+	windowAccessMaxCount = 10000
+)
+
 type datasourceJsonData struct {
-	UseExternalEspUrl bool `json:"useExternalEspUrl"`
-	OauthPassThru     bool `json:"oauthPassThru"`
-	TlsSkipVerify     bool `json:"tlsSkipVerify"`
-	DirectToEsp     bool `json:"DirectToEsp"`
+	UseExternalEspUrl  bool   `json:"useExternalEspUrl"`
+	OauthPassThru      bool   `json:"oauthPassThru"`
+	TlsSkipVerify      bool   `json:"tlsSkipVerify"`
+	DirectToEsp        bool   `json:"DirectToEsp"`
+	SubscriptionFormat string `json:"subscriptionFormat"`
+	DecodeErrorPolicy  string `json:"decodeErrorPolicy"`
+	FrameIntervalMs    uint64 `json:"frameIntervalMs"`
+	HistoryMaxEvents   uint64 `json:"historyMaxEvents"`
+	HistoryMaxAgeMs    uint64 `json:"historyMaxAgeMs"`
 }
 
 // Dispose here tells plugin SDK that plugin wants to clean up resources when a new instance
@@ -105,6 +156,8 @@ type datasourceJsonData struct {
 // be disposed and a new one will be created using NewSampleDatasource factory function.
 func (d *SampleDatasource) Dispose() {
 	// Clean up datasource instance resources.
+	d.channelQueryMap.Close()
+	d.windowAccessMap.Close()
 }
 
 // QueryData handles multiple queries and returns multiple responses.
@@ -115,9 +168,11 @@ func (d *SampleDatasource) QueryData(ctx context.Context, req *backend.QueryData
 	response := backend.NewQueryDataResponse()
 
 	var dJsonData datasourceJsonData
-	err := json.Unmarshal(req.PluginContext.DataSourceInstanceSettings.JSONData, &dJsonData)
-	if err != nil {
-		return nil, err
+	if jsonData := req.PluginContext.DataSourceInstanceSettings.JSONData; len(jsonData) > 0 {
+		err := json.Unmarshal(jsonData, &dJsonData)
+		if err != nil {
+			return nil, err
+		}
 	}
 	var authorizationHeaderPtr *string = nil
 	if dJsonData.OauthPassThru {
@@ -141,17 +196,19 @@ func (d *SampleDatasource) QueryData(ctx context.Context, req *backend.QueryData
 		}
 
 		var authHeaderToBePassed *string = nil
+		var identity string
 		if authorizationHeaderPtr != nil && d.isServerUrlTrusted(serverUrl, !d.jsonData.DirectToEsp, authorizationHeaderPtr) {
 			authHeaderToBePassed = authorizationHeaderPtr
+			identity = userIdentity(req.PluginContext.User)
 		}
 
-		response.Responses[q.RefID] = d.query(ctx, req.PluginContext.DataSourceInstanceSettings.UID, qdto, authHeaderToBePassed)
+		response.Responses[q.RefID] = d.query(ctx, req.PluginContext.DataSourceInstanceSettings.UID, qdto, identity, authHeaderToBePassed)
 	}
 
 	return response, nil
 }
 
-func (d *SampleDatasource) query(_ context.Context, datasourceUid string, qdto querydto.QueryDTO, authorizationHeader *string) backend.DataResponse {
+func (d *SampleDatasource) query(_ context.Context, datasourceUid string, qdto querydto.QueryDTO, identity string, authorizationHeader *string) backend.DataResponse {
 	var qServerUrl string
 	if d.jsonData.UseExternalEspUrl {
 		qServerUrl = qdto.ExternalServerUrl
@@ -166,11 +223,84 @@ func (d *SampleDatasource) query(_ context.Context, datasourceUid string, qdto q
 	}
 	serverUrl := s.GetUrl()
 
-	q := query.New(serverUrl, qdto.ProjectName, qdto.CqName, qdto.WindowName, qdto.Interval, qdto.MaxDataPoints, qdto.Fields, authorizationHeader)
+	format := qdto.Format
+	if format == "" {
+		format = d.jsonData.SubscriptionFormat
+	}
+	format, err = client.ParseFormat(format)
+	if err != nil {
+		return handleQueryError("invalid subscription format", err)
+	}
+
+	arrayLayout, err := framefactory.ParseArrayLayout(qdto.ArrayLayout)
+	if err != nil {
+		return handleQueryError("invalid array layout", err)
+	}
+
+	// Aggregated queries compute the average unless other functions are selected.
+	var aggregations []string
+	if qdto.AggregationInterval > 0 {
+		if qdto.Materialized || qdto.TimeField != "" {
+			return handleQueryError("aggregation cannot be combined with window contents or a time field", nil)
+		}
+
+		aggregations = []string{string(aggregation.Avg)}
+		if len(qdto.AggregationFunctions) > 0 {
+			aggregations = make([]string, 0, len(qdto.AggregationFunctions))
+			for _, name := range qdto.AggregationFunctions {
+				function, err := aggregation.ParseFunction(name)
+				if err != nil {
+					return handleQueryError("invalid aggregate function", err)
+				}
+				aggregations = append(aggregations, string(function))
+			}
+		}
+	}
+
+	var filterFields []string
+	if qdto.Filter != "" {
+		eventFilter, err := filter.Parse(qdto.Filter)
+		if err != nil {
+			return handleQueryError("invalid filter", err)
+		}
+		filterFields = eventFilter.Fields()
+	}
+
+	// The time, series and filter fields are subscribed to even if they are not among the selected fields.
+	fields := qdto.Fields
+	if len(fields) > 0 {
+		layoutFields := append(append([]string{qdto.TimeField}, qdto.SeriesFields...), filterFields...)
+		for _, layoutField := range layoutFields {
+			if layoutField != "" && !slices.Contains(fields, layoutField) {
+				fields = append(fields, layoutField)
+			}
+		}
+	}
+
+	q := query.New(serverUrl, qdto.ProjectName, qdto.CqName, qdto.WindowName, qdto.Interval, qdto.MaxDataPoints, fields, query.Options{
+		Format:              format,
+		Materialized:        qdto.Materialized,
+		TimeField:           qdto.TimeField,
+		OmitEventTimestamp:  qdto.OmitEventTimestamp,
+		SeriesFields:        qdto.SeriesFields,
+		ArrayLayout:         string(arrayLayout),
+		AggregationInterval: qdto.AggregationInterval,
+		Aggregations:        aggregations,
+		Filter:              qdto.Filter,
+		UserIdentity:        identity,
+	}, authorizationHeader)
+
+	// Streams run with the credentials of a user can only be subscribed to by that user.
+	if authorizationHeader != nil && identity == "" {
+		return handleQueryError("streaming with forwarded OAuth identity requires a signed-in user", nil)
+	}
 
 	channelPath := q.ToChannelPath()
 
-	d.channelQueryMap.Set(channelPath, q)
+	err = d.channelQueryMap.Set(channelPath, q)
+	if err != nil {
+		return handleQueryError("too many active streams", err)
+	}
 
 	log.DefaultLogger.Debug("Received query", "path", channelPath, "query", q)
 
@@ -184,6 +314,8 @@ func (d *SampleDatasource) query(_ context.Context, datasourceUid string, qdto q
 		Path:      channelPath,
 	}
 
+	// The frame holds no data, as window contents are only received over the websocket subscription of the stream.
+	// Snapshot queries for alerting and reporting need an ESP endpoint returning the contents of a window at once.
 	frame := data.NewFrame("response")
 	frame.SetMeta(&data.FrameMeta{Channel: channel.String()})
 
@@ -193,8 +325,51 @@ func (d *SampleDatasource) query(_ context.Context, datasourceUid string, qdto q
 	return response
 }
 
+// newEventFilter returns the parsed filter of a query, or nil if it has none. Filters are validated when queries are
+// created.
+func newEventFilter(q *query.Query) *filter.Expression {
+	if q.Filter == "" {
+		return nil
+	}
+
+	eventFilter, err := filter.Parse(q.Filter)
+	if err != nil {
+		log.DefaultLogger.Error("Invalid filter of query", "filter", q.Filter, "error", err)
+		return nil
+	}
+
+	return eventFilter
+}
+
+// newFrameOptions returns the layout of the frames of a query.
+func newFrameOptions(q *query.Query) framefactory.FrameOptions {
+	return framefactory.FrameOptions{
+		TimeField:          q.TimeField,
+		OmitEventTimestamp: q.OmitEventTimestamp,
+		ArrayLayout:        framefactory.ArrayLayout(q.ArrayLayout),
+	}
+}
+
+// userIdentity returns the identity that streams run with the credentials of the given user are bound to, a hash of
+// their login. An empty string is returned if there is no user.
+func userIdentity(user *backend.User) string {
+	if user == nil || user.Login == "" {
+		return ""
+	}
+
+	hashSum := sha256.Sum256([]byte(user.Login))
+
+	return fmt.Sprintf("%x", hashSum)
+}
+
+// handleQueryError logs the error of a query and returns a response carrying the message. The error may be nil for
+// queries that are invalid in themselves.
 func handleQueryError(errorMessage string, err error) backend.DataResponse {
-	log.DefaultLogger.Error(errorMessage, "error", err)
+	if err != nil {
+		log.DefaultLogger.Error(errorMessage, "error", err)
+	} else {
+		log.DefaultLogger.Error(errorMessage)
+	}
 	response := backend.DataResponse{
 		Error: errors.New(errorMessage),
 	}
@@ -302,76 +477,209 @@ func (d *SampleDatasource) SubscribeStream(_ context.Context, req *backend.Subsc
 
 	status := backend.SubscribeStreamStatusPermissionDenied
 
-	if _, err := d.channelQueryMap.Get(req.Path); err == nil {
-		// Allow subscribing only on expected path.
-		status = backend.SubscribeStreamStatusOK
+	// Allow subscribing only on expected path, and to streams run with the credentials of a user only by that user.
+	if q, err := d.channelQueryMap.Get(req.Path); err == nil {
+		if reason := d.authorizeSubscription(req, q); reason == "" {
+			status = backend.SubscribeStreamStatusOK
+		} else {
+			var login string
+			if req.PluginContext.User != nil {
+				login = req.PluginContext.User.Login
+			}
+			log.DefaultLogger.Warn("Audit: denied stream subscription", "user", login, "path", req.Path, "project", q.ProjectName, "cq", q.CqName, "window", q.WindowName, "reason", reason)
+		}
 	}
 
-	return &backend.SubscribeStreamResponse{
+	response := &backend.SubscribeStreamResponse{
 		Status: status,
-	}, nil
+	}
+
+	// Subscribers joining a running stream receive its recent history first.
+	if batcher, err := d.channelBatcherMap.Get(req.Path); err == nil && status == backend.SubscribeStreamStatusOK {
+		if frame := batcher.initialFrame(); frame != nil {
+			initialData, err := backend.NewInitialFrame(frame, data.IncludeAll)
+			if err != nil {
+				log.DefaultLogger.Error("Unable to create initial data of stream", "path", req.Path, "error", err)
+			} else {
+				response.InitialData = initialData
+			}
+		}
+	}
+
+	return response, nil
 }
 
-// RunStream is called once for any open channel.  Results are shared with everyone
-// subscribed to the same channel.
-func (d *SampleDatasource) RunStream(ctx context.Context, req *backend.RunStreamRequest, sender *backend.StreamSender) error {
-	log.DefaultLogger.Debug("initiating stream", "path", req.Path)
+// authorizeSubscription returns the reason for denying a subscription to the stream of a query, or an empty string if
+// it is allowed. Streams run with the credentials of a user can only be subscribed to by that user, and only while the
+// forwarded OAuth token of the subscriber can read the window of the query.
+func (d *SampleDatasource) authorizeSubscription(req *backend.SubscribeStreamRequest, q *query.Query) string {
+	if q.AuthorizationHeader == nil {
+		return ""
+	}
 
-	queryKey := req.Path
+	if q.UserIdentity == "" || q.UserIdentity != userIdentity(req.PluginContext.User) {
+		return "stream belongs to another user"
+	}
 
-	q, err := d.channelQueryMap.Get(queryKey)
+	authorizationHeader := req.GetHTTPHeader(backend.OAuthIdentityTokenHeaderName)
+	if authorizationHeader == "" {
+		return "no OAuth token forwarded"
+	}
+
+	canRead, err := d.canReadWindow(authorizationHeader, q)
 	if err != nil {
-		// The channel refers to an unknown query.
-		// Avoid returning the error, to prevent continuous attempts from Grafana to re-establish the stream.
-		log.DefaultLogger.Error(fmt.Sprintf("query not found for channel %v", req.Path), "error", err)
-		return nil
+		log.DefaultLogger.Error("Unable to check window access", "path", req.Path, "error", err)
+		return "window access could not be checked"
+	}
+	if !canRead {
+		return "OAuth token cannot read the window"
 	}
 
-	log.DefaultLogger.Debug("Instantiating new ESP websocket client from query", "query", q)
-	espWsClient := client.New(q.ServerUrl, q.AuthorizationHeader)
-	defer espWsClient.Close()
+	return ""
+}
 
-	subscribeToQuery := func() {
-		// Clear any preceding errors prior to subscribing
-		sendErrorClearFrame(sender)
+// canReadWindow returns whether an OAuth token can read the window of a query, which is the case when the ESP server
+// or discovery service lists the window of the query when asked with the token. Outcomes are cached by a hash of the
+// token and the window.
+func (d *SampleDatasource) canReadWindow(authorizationHeader string, q *query.Query) (bool, error) {
+	key := windowAccessKey(authorizationHeader, q)
+	if canRead, err := d.windowAccessMap.Get(key); err == nil {
+		return *canRead, nil
+	}
 
-		err := espWsClient.Subscribe(q.ProjectName, q.CqName, q.WindowName, q.EventInterval, q.MaxEvents, q.Fields)
-		if err != nil {
-			log.DefaultLogger.Error(fmt.Sprintf("error while subscribing to events on channel %v", req.Path), "error", err)
-		}
+	espServerInfoList, err := d.fetchServerInfo(&authorizationHeader)
+	if err != nil {
+		return false, err
 	}
 
-	espWsClient.OnConnected = subscribeToQuery
+	canRead := listsWindow(*espServerInfoList, q)
+	err = d.windowAccessMap.Set(key, &canRead)
+	if err != nil {
+		log.DefaultLogger.Warn("Unable to cache window access", "error", err)
+	}
 
-	espWsClient.OnProjectLoaded = func(projectName string) {
-		if q.ProjectName != projectName {
-			return
-		}
+	return canRead, nil
+}
 
-		subscribeToQuery()
+func windowAccessKey(authorizationHeader string, q *query.Query) string {
+	var key string
+	for _, component := range []string{authorizationHeader, q.ServerUrl.String(), q.ProjectName, q.CqName, q.WindowName} {
+		key += fmt.Sprintf("%d:%s", len(component), component)
 	}
+	hashSum := sha256.Sum256([]byte(key))
+
+	return fmt.Sprintf("%x", hashSum)
+}
 
-	espWsClient.OnProjectRemoved = func(projectName string) {
-		if q.ProjectName != projectName {
-			return
+// listsWindow returns whether the window of a query is listed for the ESP server of the query.
+func listsWindow(espServerInfoList []espServerInfo, q *query.Query) bool {
+	for _, espServer := range espServerInfoList {
+		if !isServerOfQuery(espServer, q) {
+			continue
 		}
 
-		projectRemovedMessage := fmt.Sprintf("Project '%s' is not running", projectName)
-		sendErrorFrame(projectRemovedMessage, sender)
+		for _, p := range espServer.Projects {
+			for _, cq := range p.ContinuousQueries {
+				for _, w := range cq.Windows {
+					if p.Name == q.ProjectName && cq.Name == q.CqName && w.Name == q.WindowName {
+						return true
+					}
+				}
+			}
+		}
 	}
 
-	espWsClient.OnEventMessageReceived = func(we windowevent.WindowEvent) {
-		frame := framefactory.NewWindowEventFrame(we)
+	return false
+}
 
-		err := sender.SendFrame(frame, data.IncludeAll)
+// isServerOfQuery returns whether either URL of an ESP server leads to the websocket connection URL of a query.
+func isServerOfQuery(espServer espServerInfo, q *query.Query) bool {
+	for _, serverUrl := range []url.URL{espServer.Url, espServer.ExternalUrl} {
+		s, err := server.FromUrlString(serverUrl.String())
 		if err != nil {
-			log.DefaultLogger.Error("Error sending data frame", "error", err)
+			continue
+		}
+
+		if connectionUrl := s.GetUrl(); connectionUrl.String() == q.ServerUrl.String() {
+			return true
 		}
 	}
 
-	go espWsClient.Connect()
+	return false
+}
+
+// RunStream is called once for any open channel.  Results are shared with everyone
+// subscribed to the same channel.
+func (d *SampleDatasource) RunStream(ctx context.Context, req *backend.RunStreamRequest, sender *backend.StreamSender) error {
+	log.DefaultLogger.Debug("initiating stream", "path", req.Path)
+
+	queryKey := req.Path
+
+	q, err := d.channelQueryMap.Pin(queryKey)
+	if err != nil {
+		// The channel refers to an unknown or expired query.
+		// Avoid returning the error, to prevent continuous attempts from Grafana to re-establish the stream.
+		log.DefaultLogger.Error(fmt.Sprintf("query not found for channel %v", req.Path), "error", err)
+		return nil
+	}
+	defer d.channelQueryMap.Unpin(queryKey)
+
+	log.DefaultLogger.Debug("Acquiring pooled ESP websocket connection for query", "query", q)
+	lease := d.connectionPool.Acquire(q.ServerUrl, q.AuthorizationHeader)
+	defer lease.Release()
+
+	// Only the events received from the subscription are sent, as backfilling the dashboard time range needs an ESP
+	// endpoint returning the retained events of a window.
+	sub, err := lease.Subscribe(q.ProjectName, q.CqName, q.WindowName, q.EventInterval, q.MaxEvents, q.Fields, q.Format, q.Materialized)
+	if err != nil {
+		log.DefaultLogger.Error(fmt.Sprintf("error while subscribing to events on channel %v", req.Path), "error", err)
+		return err
+	}
+
+	// Materialized queries maintain the current contents of the window, which are sent as a whole on every event.
+	var state *windowstate.WindowState
+	if q.Materialized {
+		state = windowstate.New(windowStateMaxRows)
+	}
+
+	// Events are coalesced into one frame per frame interval if one is set, and always for materialized queries.
+	frameInterval := time.Duration(d.jsonData.FrameIntervalMs) * time.Millisecond
+	if q.Materialized {
+		frameInterval = max(frameInterval, materializedFrameInterval)
+	}
+	var flushTicks <-chan time.Time
+	if frameInterval > 0 {
+		ticker := time.NewTicker(frameInterval)
+		defer ticker.Stop()
+		flushTicks = ticker.C
+	}
+	batcher := newWindowEventBatcher(sender, newFrameOptions(q), state, flushTicks != nil)
+	batcher.filter = newEventFilter(q)
+	if len(q.SeriesFields) > 0 {
+		batcher.series = framefactory.NewSeriesLayout(q.SeriesFields)
+	}
+	if d.jsonData.HistoryMaxEvents > 0 {
+		batcher.history = eventhistory.New(int(min(d.jsonData.HistoryMaxEvents, historyMaxEvents)), time.Duration(d.jsonData.HistoryMaxAgeMs)*time.Millisecond)
+	}
+	d.channelBatcherMap.Set(queryKey, batcher)
+	defer d.channelBatcherMap.Delete(queryKey)
+
+	// Aggregated queries send the aggregates of every bucket instead of the events, grouped by the series fields.
+	var aggregationTicks <-chan time.Time
+	if q.AggregationInterval > 0 {
+		interval := time.Duration(q.AggregationInterval) * time.Millisecond
+		functions := make([]aggregation.Function, 0, len(q.Aggregations))
+		for _, name := range q.Aggregations {
+			functions = append(functions, aggregation.Function(name))
+		}
+		batcher.aggregator = aggregation.New(interval, functions, q.SeriesFields)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		aggregationTicks = ticker.C
+	}
 
-	// Stream data frames periodically till stream closed by Grafana.
+	// Stream data frames till stream closed by Grafana.
 	for {
 		select {
 		case <-ctx.Done():
@@ -381,15 +689,75 @@ func (d *SampleDatasource) RunStream(ctx context.Context, req *backend.RunStream
 			d.channelQueryMap.Delete(queryKey)
 
 			return nil
-		case err := <-espWsClient.Errors:
-			errorMessage := err.Error()
-			log.DefaultLogger.Error(errorMessage, "err", err.Error())
-			sendErrorFrame(errorMessage, sender)
-			return err
+		case <-flushTicks:
+			batcher.flush()
+		case <-aggregationTicks:
+			batcher.tick()
+		case event := <-lease.Events():
+			handleConnectionEvent(event, q, sender)
+		case event, ok := <-sub.Events():
+			if !ok {
+				log.DefaultLogger.Debug("Subscription closed, finish streaming", "path", req.Path)
+				batcher.flush()
+				return nil
+			}
+
+			err := handleSubscriptionEvent(event, batcher, sender)
+			if err != nil {
+				return err
+			}
 		}
 	}
 }
 
+func handleConnectionEvent(event client.Event, q *query.Query, sender *backend.StreamSender) {
+	switch e := event.(type) {
+	case client.ConnectionStateChanged:
+		switch e.State {
+		case client.ConnectionStateConnected:
+			// Clear any preceding errors once the subscription has been (re-)established
+			sendErrorClearFrame(sender)
+		case client.ConnectionStateReconnecting:
+			statusMessage := fmt.Sprintf("Connection to ESP server lost, reconnecting in %s (attempt %d)", e.ReconnectDelay.Round(time.Millisecond), e.ReconnectAttempt)
+			sendStatusFrame(statusMessage, sender)
+		}
+	case client.ProjectLoaded:
+		if q.ProjectName == e.ProjectName {
+			sendErrorClearFrame(sender)
+		}
+	case client.ProjectRemoved:
+		if q.ProjectName == e.ProjectName {
+			projectRemovedMessage := fmt.Sprintf("Project '%s' is not running", e.ProjectName)
+			sendErrorFrame(projectRemovedMessage, sender)
+		}
+	case client.EventsDiscarded:
+		log.DefaultLogger.Debug("ESP server discarded events", "discarded", e.Discarded, "total", e.Total)
+	}
+}
+
+func handleSubscriptionEvent(event client.Event, batcher *windowEventBatcher, sender *backend.StreamSender) error {
+	switch e := event.(type) {
+	case client.SchemaReceived:
+		batcher.setSchema(e.Schema)
+	case client.Resubscribed:
+		batcher.reset()
+	case client.WindowEventsReceived:
+		batcher.add(e.WindowEvents)
+	case client.ErrorReceived:
+		return handleStreamError(e.Err, sender)
+	}
+
+	return nil
+}
+
+func handleStreamError(err error, sender *backend.StreamSender) error {
+	errorMessage := err.Error()
+	log.DefaultLogger.Error(errorMessage, "err", err.Error())
+	sendErrorFrame(errorMessage, sender)
+
+	return err
+}
+
 func sendErrorFrame(errorMessage string, sender *backend.StreamSender) {
 	frame := framefactory.NewErrorFrame(errorMessage)
 
@@ -399,6 +767,15 @@ func sendErrorFrame(errorMessage string, sender *backend.StreamSender) {
 	}
 }
 
+func sendStatusFrame(statusMessage string, sender *backend.StreamSender) {
+	frame := framefactory.NewStatusFrame(statusMessage)
+
+	sendError := sender.SendFrame(frame, data.IncludeAll)
+	if sendError != nil {
+		log.DefaultLogger.Error("Error sending status frame", "error", sendError)
+	}
+}
+
 func sendErrorClearFrame(sender *backend.StreamSender) {
 	frame := framefactory.NewErrorClearFrame()
 
@@ -521,10 +898,10 @@ func (d *SampleDatasource) fetchServerInfoFromDiscoveryEndpoint(authHeader *stri
 				"authorizationHeaderPresent", hasAuthHeader,
 				"oauthPassThru", d.jsonData.OauthPassThru,
 			)
-			return nil, fmt.Errorf(message)
+			return nil, errors.New(message)
 		default:
 			var message = fmt.Sprintf("The discovery service sent an unexpected HTTP status code: %d", resp.StatusCode)
-			return nil, fmt.Errorf(message)
+			return nil, errors.New(message)
 		}
 	}
 
@@ -587,6 +964,7 @@ type espRunningProjectsFromXml struct {
 					Name   string `xml:"name,attr"`
 					Fields []struct {
 						Name string `xml:"name,attr"`
+						Type string `xml:"type,attr"`
 					} `xml:"schema>fields>field"`
 				} `xml:",any"`
 			} `xml:"windows"`
@@ -619,6 +997,7 @@ type window struct {
 
 type field struct {
 	Name string `json:"name"`
+	Type string `json:"type,omitempty"`
 }
 
 func (d *SampleDatasource) fetchServerInfo(authHeader *string) (*[]espServerInfo, error) {
@@ -674,7 +1053,7 @@ func (d *SampleDatasource) fetchServerInfoFromEspInstance(authHeader *string) (*
 				"authorizationHeaderPresent", hasAuthHeader,
 				"oauthPassThru", d.jsonData.OauthPassThru,
 			)
-			return nil, fmt.Errorf(message)
+			return nil, errors.New(message)
 		default:
 			var message = fmt.Sprintf("The ESP server sent an unexpected HTTP status code: %d", resp.StatusCode)
 
@@ -685,7 +1064,7 @@ func (d *SampleDatasource) fetchServerInfoFromEspInstance(authHeader *string) (*
 				log.DefaultLogger.Debug("Unexpected ESP server response. Unable to serialize response body.")
 			}
 
-			return nil, fmt.Errorf(message)
+			return nil, errors.New(message)
 		}
 	}
 
@@ -725,7 +1104,7 @@ func (t *espRunningProjectsFromXml) toEspServerInfo(url url.URL) espServerInfo {
 			for _, w := range cq.Windows.Windows {
 				var fields []field
 				for _, f := range w.Fields {
-					fields = append(fields, field{Name: f.Name})
+					fields = append(fields, field{Name: f.Name, Type: f.Type})
 				}
 				windows = append(windows, window{Name: w.Name, Fields: fields})
 			}
@@ -0,0 +1,108 @@
+/*
+	Copyright © 2023, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+	SPDX-License-Identifier: Apache-2.0
+*/
+
+package plugin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"grafana-esp-plugin/internal/esp/fakeserver"
+	"grafana-esp-plugin/internal/plugin/query"
+	"grafana-esp-plugin/internal/plugin/registry"
+	"grafana-esp-plugin/internal/plugin/syncmap"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestSubscribeStreamOfUserCredentials(t *testing.T) {
+	s := fakeserver.New()
+	httpServer := httptest.NewServer(s.Handler())
+	t.Cleanup(httpServer.Close)
+	s.SetAuthorizedHeaders("Bearer alice", "Bearer refreshed")
+	s.SetProjects([]fakeserver.Project{{
+		Name: "project",
+		ContinuousQueries: []fakeserver.ContinuousQuery{{
+			Name:    "cq",
+			Windows: []fakeserver.Window{{Name: "window", Type: "window-source"}},
+		}},
+	}})
+
+	restUrl, err := url.Parse(httpServer.URL)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	serverUrl, err := url.Parse(strings.Replace(httpServer.URL, "http://", "ws://", 1) + "/connect")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	d := &SampleDatasource{
+		channelQueryMap:   registry.New[string, query.Query]("test", time.Minute, 0),
+		channelBatcherMap: syncmap.New[string, windowEventBatcher](),
+		httpClient:        http.DefaultClient,
+		jsonData:          datasourceJsonData{DirectToEsp: true, OauthPassThru: true},
+		url:               *restUrl,
+		windowAccessMap:   registry.New[string, bool]("test", time.Minute, 0),
+	}
+	t.Cleanup(d.Dispose)
+
+	authorizationHeader := "Bearer alice"
+	alice := &backend.User{Login: "alice"}
+	q := query.New(*serverUrl, "project", "cq", "window", 0, 0, nil, query.Options{Format: "json", UserIdentity: userIdentity(alice)}, &authorizationHeader)
+	otherWindowQuery := query.New(*serverUrl, "project", "cq", "other", 0, 0, nil, query.Options{Format: "json", UserIdentity: userIdentity(alice)}, &authorizationHeader)
+	for _, registered := range []*query.Query{q, otherWindowQuery} {
+		if err := d.channelQueryMap.Set(registered.ToChannelPath(), registered); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	subscribe := func(q *query.Query, user *backend.User, authorizationHeader string) backend.SubscribeStreamStatus {
+		req := &backend.SubscribeStreamRequest{
+			PluginContext: backend.PluginContext{User: user},
+			Path:          q.ToChannelPath(),
+		}
+		if authorizationHeader != "" {
+			req.SetHTTPHeader(backend.OAuthIdentityTokenHeaderName, authorizationHeader)
+		}
+
+		response, err := d.SubscribeStream(context.Background(), req)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		return response.Status
+	}
+
+	for _, test := range []struct {
+		query               *query.Query
+		user                *backend.User
+		authorizationHeader string
+		expected            backend.SubscribeStreamStatus
+	}{
+		{q, alice, "Bearer alice", backend.SubscribeStreamStatusOK},
+		{q, alice, "Bearer refreshed", backend.SubscribeStreamStatusOK},
+		{q, alice, "Bearer revoked", backend.SubscribeStreamStatusPermissionDenied},
+		{q, alice, "", backend.SubscribeStreamStatusPermissionDenied},
+		{q, &backend.User{Login: "bob"}, "Bearer alice", backend.SubscribeStreamStatusPermissionDenied},
+		{q, nil, "Bearer alice", backend.SubscribeStreamStatusPermissionDenied},
+		{otherWindowQuery, alice, "Bearer alice", backend.SubscribeStreamStatusPermissionDenied},
+	} {
+		if status := subscribe(test.query, test.user, test.authorizationHeader); status != test.expected {
+			t.Errorf("expected %v, got %v", test.expected, status)
+		}
+	}
+
+	// The outcome of the check is reused while it is cached.
+	s.SetProjects(nil)
+	if status := subscribe(q, alice, "Bearer alice"); status != backend.SubscribeStreamStatusOK {
+		t.Errorf("expected %v, got %v", backend.SubscribeStreamStatusOK, status)
+	}
+}
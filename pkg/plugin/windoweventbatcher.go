@@ -0,0 +1,248 @@
+/*
+   Copyright © 2023, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+   SPDX-License-Identifier: Apache-2.0
+*/
+
+package plugin
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"grafana-esp-plugin/internal/esp/aggregation"
+	"grafana-esp-plugin/internal/esp/eventhistory"
+	espfield "grafana-esp-plugin/internal/esp/field"
+	"grafana-esp-plugin/internal/esp/filter"
+	"grafana-esp-plugin/internal/esp/windowevent"
+	"grafana-esp-plugin/internal/esp/windowstate"
+	"grafana-esp-plugin/internal/framefactory"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// frameSender sends frames to the subscribers of a stream, as backend.StreamSender does.
+type frameSender interface {
+	SendFrame(frame *data.Frame, include data.FrameInclude) error
+}
+
+// windowEventBatcher sends the window events of a subscription as frames laid out by the subscription schema. The
+// events received together are sent in a single frame, unless coalescing is enabled, in which case the events
+// received since the last flush are. If a window state is set, the events are applied to it and frames hold the
+// current rows of the window instead. If a series layout is set, frames are converted to wide time series. If an
+// aggregator is set, the aggregated events of its completed buckets are sent instead of the events. If a history is
+// set, the sent events are kept in it for the initial frames of later subscribers of the stream. If a filter is set, only
+// the events satisfying it are passed on, or with a window state, only the rows satisfying it are sent, as updates
+// can move rows into and out of the filter.
+//
+// The batcher is used by the goroutine running the stream, while initial frames are requested by other goroutines.
+type windowEventBatcher struct {
+	mu         sync.Mutex
+	sender     frameSender
+	options    framefactory.FrameOptions
+	schema     *espfield.Schema
+	state      *windowstate.WindowState
+	series     *framefactory.SeriesLayout
+	aggregator *aggregation.Aggregator
+	history    *eventhistory.History
+	filter     *filter.Expression
+	coalesce   bool
+	pending    []windowevent.WindowEvent
+	changed    bool
+	evicted    uint64
+}
+
+func newWindowEventBatcher(sender frameSender, options framefactory.FrameOptions, state *windowstate.WindowState, coalesce bool) *windowEventBatcher {
+	return &windowEventBatcher{
+		sender:   sender,
+		options:  options,
+		state:    state,
+		coalesce: coalesce,
+	}
+}
+
+// setSchema sets the schema of the subscription. Pending events, which follow the previous schema, are sent first.
+// The history is cleared if the schema changed, unless events are aggregated.
+func (b *windowEventBatcher) setSchema(schema *espfield.Schema) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state != nil {
+		b.state.SetSchema(schema)
+		b.changed = true
+	} else {
+		b.send()
+	}
+
+	if b.history != nil && b.aggregator == nil && b.schema != nil && !b.schema.Equal(schema) {
+		b.history.Reset()
+	}
+
+	b.schema = schema
+}
+
+// reset clears the window state, whose rows are sent anew by the server once the subscription is re-established. The
+// cleared state is sent on the next flush, or along with the next events if not coalescing.
+func (b *windowEventBatcher) reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == nil {
+		return
+	}
+
+	b.state.Reset()
+	b.changed = true
+	b.evicted = 0
+}
+
+func (b *windowEventBatcher) add(windowEvents []windowevent.WindowEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.filter != nil && b.state == nil {
+		windowEvents = b.filter.Filter(windowEvents)
+	}
+
+	b.queue(windowEvents)
+
+	if !b.coalesce {
+		b.send()
+	}
+}
+
+// queue passes window events on to the aggregator, the window state or the pending events.
+func (b *windowEventBatcher) queue(windowEvents []windowevent.WindowEvent) {
+	if b.aggregator != nil {
+		b.aggregator.Add(windowEvents)
+		windowEvents = b.aggregator.Completed()
+	}
+
+	if b.state != nil {
+		for _, windowEvent := range windowEvents {
+			b.state.Apply(windowEvent)
+		}
+		b.changed = true
+	} else {
+		b.pending = append(b.pending, windowEvents...)
+	}
+}
+
+// tick passes the aggregated events of the buckets completed by the passing of time on, if aggregating.
+func (b *windowEventBatcher) tick() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.aggregator == nil {
+		return
+	}
+
+	b.pending = append(b.pending, b.aggregator.Tick()...)
+	if !b.coalesce {
+		b.send()
+	}
+}
+
+// flush sends the pending events, or the rows of the window state if it changed since the last flush.
+func (b *windowEventBatcher) flush() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.send()
+}
+
+// initialFrame returns the frame sent to new subscribers of the stream, holding the current rows of the window
+// state or the events of the history. Nil is returned if there is neither, or if they are empty.
+func (b *windowEventBatcher) initialFrame() *data.Frame {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var windowEvents []windowevent.WindowEvent
+	if b.state != nil {
+		windowEvents = b.rows()
+	} else if b.history != nil {
+		windowEvents = b.history.Events(time.Now())
+	}
+	if len(windowEvents) == 0 {
+		return nil
+	}
+
+	frame, err := b.newFrame(windowEvents)
+	if err != nil {
+		log.DefaultLogger.Error("Unable to create initial data frame from window events", "error", err)
+		return nil
+	}
+
+	return frame
+}
+
+func (b *windowEventBatcher) send() {
+	var windowEvents []windowevent.WindowEvent
+	if b.state != nil {
+		if !b.changed {
+			return
+		}
+		windowEvents = b.rows()
+		b.changed = false
+
+		if evicted := b.state.Evicted(); evicted > b.evicted {
+			if b.evicted == 0 {
+				log.DefaultLogger.Warn("Window state exceeds its maximum number of rows, evicting the oldest rows", "maxRows", b.state.MaxRows())
+			}
+			b.evicted = evicted
+		}
+	} else {
+		if len(b.pending) == 0 {
+			return
+		}
+		windowEvents = b.pending
+		b.pending = nil
+
+		if b.history != nil {
+			b.history.Add(windowEvents, time.Now())
+		}
+	}
+
+	frame, err := b.newFrame(windowEvents)
+	if err != nil {
+		// Errors of the frame layout persist until the query is changed, so they are reported to the panel.
+		log.DefaultLogger.Error("Unable to create data frame from window events", "error", err)
+		frame = framefactory.NewErrorFrame(err.Error())
+	}
+
+	err = b.sender.SendFrame(frame, data.IncludeAll)
+	if err != nil {
+		log.DefaultLogger.Error("Error sending data frame", "error", err)
+	}
+}
+
+// rows returns the current rows of the window state that satisfy the filter.
+func (b *windowEventBatcher) rows() []windowevent.WindowEvent {
+	if b.filter == nil {
+		return b.state.Rows()
+	}
+
+	return b.filter.Filter(b.state.Rows())
+}
+
+func (b *windowEventBatcher) newFrame(windowEvents []windowevent.WindowEvent) (*data.Frame, error) {
+	// Aggregated events are not laid out by the schema, as they hold aggregates of its fields.
+	schema := b.schema
+	if b.aggregator != nil {
+		schema = nil
+	}
+
+	frame, err := framefactory.NewWindowEventsFrame(schema, windowEvents, b.options)
+	if err == nil && b.series != nil {
+		frame, err = b.series.ToWideFrame(frame)
+	}
+	if err == nil && b.state != nil && b.state.Evicted() > 0 {
+		frame.AppendNotices(data.Notice{
+			Severity: data.NoticeSeverityWarning,
+			Text:     fmt.Sprintf("The window holds more than %d rows, only the %d most recently inserted rows are shown", b.state.MaxRows(), b.state.MaxRows()),
+		})
+	}
+
+	return frame, err
+}
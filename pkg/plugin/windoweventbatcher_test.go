@@ -0,0 +1,270 @@
+/*
+	Copyright © 2023, SAS Institute Inc., Cary, NC, USA.  All Rights Reserved.
+	SPDX-License-Identifier: Apache-2.0
+*/
+
+package plugin
+
+import (
+	"testing"
+	"time"
+
+	"grafana-esp-plugin/internal/esp/aggregation"
+	"grafana-esp-plugin/internal/esp/eventhistory"
+	espfield "grafana-esp-plugin/internal/esp/field"
+	"grafana-esp-plugin/internal/esp/filter"
+	"grafana-esp-plugin/internal/esp/windowevent"
+	"grafana-esp-plugin/internal/esp/windowstate"
+	"grafana-esp-plugin/internal/framefactory"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+type recordingSender struct {
+	frames []*data.Frame
+}
+
+func (s *recordingSender) SendFrame(frame *data.Frame, _ data.FrameInclude) error {
+	s.frames = append(s.frames, frame)
+	return nil
+}
+
+func (s *recordingSender) rowCounts() []int {
+	rowCounts := make([]int, 0, len(s.frames))
+	for _, frame := range s.frames {
+		rowCount, _ := frame.RowLen()
+		rowCounts = append(rowCounts, rowCount)
+	}
+
+	return rowCounts
+}
+
+var idSchemaField = &espfield.SchemaField{Name: "id", Type: espfield.Int64, TypeName: "int64", Precision: -1, Key: true}
+
+func newTestEvents(opcode string, ids ...int64) []windowevent.WindowEvent {
+	windowEvents := make([]windowevent.WindowEvent, 0, len(ids))
+	for _, id := range ids {
+		windowEvents = append(windowEvents, windowevent.New(time.UnixMicro(id), opcode, []espfield.Field{espfield.FromSchema(idSchemaField, id)}))
+	}
+
+	return windowEvents
+}
+
+func assertRowCounts(t *testing.T, sender *recordingSender, expected ...int) {
+	actual := sender.rowCounts()
+	if len(actual) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, actual)
+	}
+	for i := range expected {
+		if actual[i] != expected[i] {
+			t.Errorf("expected %v, got %v", expected, actual)
+		}
+	}
+}
+
+func TestWindowEventBatcherSendsFramePerBatch(t *testing.T) {
+	sender := &recordingSender{}
+	batcher := newWindowEventBatcher(sender, framefactory.FrameOptions{}, nil, false)
+
+	batcher.add(newTestEvents("insert", 1, 2, 3))
+	batcher.add(newTestEvents("insert", 4))
+
+	assertRowCounts(t, sender, 3, 1)
+}
+
+func TestWindowEventBatcherCoalescesUntilFlush(t *testing.T) {
+	sender := &recordingSender{}
+	batcher := newWindowEventBatcher(sender, framefactory.FrameOptions{}, nil, true)
+
+	batcher.add(newTestEvents("insert", 1, 2))
+	batcher.add(newTestEvents("insert", 3))
+	assertRowCounts(t, sender)
+
+	batcher.flush()
+	batcher.flush()
+	assertRowCounts(t, sender, 3)
+}
+
+func TestWindowEventBatcherSendsWindowState(t *testing.T) {
+	sender := &recordingSender{}
+	batcher := newWindowEventBatcher(sender, framefactory.FrameOptions{}, windowstate.New(0), true)
+
+	batcher.add(newTestEvents("insert", 1, 2, 3))
+	batcher.add(newTestEvents("delete", 2))
+	batcher.flush()
+	batcher.flush()
+
+	assertRowCounts(t, sender, 2)
+}
+
+func TestWindowEventBatcherResetsWindowState(t *testing.T) {
+	sender := &recordingSender{}
+	batcher := newWindowEventBatcher(sender, framefactory.FrameOptions{}, windowstate.New(0), true)
+
+	batcher.add(newTestEvents("insert", 1, 2, 3))
+	batcher.flush()
+	batcher.reset()
+	batcher.flush()
+	batcher.reset()
+	batcher.add(newTestEvents("insert", 4))
+	batcher.flush()
+
+	assertRowCounts(t, sender, 3, 0, 1)
+}
+
+func TestWindowEventBatcherNotesEvictedRows(t *testing.T) {
+	sender := &recordingSender{}
+	batcher := newWindowEventBatcher(sender, framefactory.FrameOptions{}, windowstate.New(2), false)
+
+	batcher.add(newTestEvents("insert", 1, 2))
+	batcher.add(newTestEvents("insert", 3))
+	assertRowCounts(t, sender, 2, 2)
+
+	if meta := sender.frames[0].Meta; meta != nil && len(meta.Notices) > 0 {
+		t.Errorf("expected no notices, got %v", meta.Notices)
+	}
+	if meta := sender.frames[1].Meta; meta == nil || len(meta.Notices) != 1 {
+		t.Errorf("expected %v notice, got %v", 1, meta)
+	}
+}
+
+func TestWindowEventBatcherReportsLayoutErrors(t *testing.T) {
+	sender := &recordingSender{}
+	batcher := newWindowEventBatcher(sender, framefactory.FrameOptions{TimeField: "missing"}, nil, false)
+	batcher.setSchema(espfield.NewSchema([]*espfield.SchemaField{idSchemaField}))
+
+	batcher.add(newTestEvents("insert", 1))
+
+	if len(sender.frames) != 1 || sender.frames[0].Name != "error" {
+		t.Errorf("expected error frame, got %v", sender.frames)
+	}
+}
+
+func TestWindowEventBatcherSendsSeries(t *testing.T) {
+	sender := &recordingSender{}
+	batcher := newWindowEventBatcher(sender, framefactory.FrameOptions{}, nil, false)
+	batcher.series = framefactory.NewSeriesLayout([]string{"id"})
+
+	batcher.add(newTestEvents("insert", 1, 2))
+
+	if len(sender.frames) != 1 || sender.frames[0].Meta == nil || sender.frames[0].Meta.Type != data.FrameTypeTimeSeriesWide {
+		t.Errorf("expected wide time series frame, got %v", sender.frames)
+	}
+}
+
+func TestWindowEventBatcherSendsAggregates(t *testing.T) {
+	sender := &recordingSender{}
+	batcher := newWindowEventBatcher(sender, framefactory.FrameOptions{}, nil, false)
+	batcher.aggregator = aggregation.New(time.Second, []aggregation.Function{aggregation.Count}, nil)
+	batcher.setSchema(espfield.NewSchema([]*espfield.SchemaField{idSchemaField}))
+
+	batcher.add(newTestEvents("insert", 1, 2))
+	batcher.tick()
+	assertRowCounts(t, sender)
+
+	batcher.tick()
+	assertRowCounts(t, sender, 1)
+
+	countField, _ := sender.frames[0].FieldByName(aggregation.Count.FieldName("id"))
+	if countField == nil {
+		t.Fatalf("expected %v field, got %v", aggregation.Count.FieldName("id"), sender.frames[0].Fields)
+	}
+	if count, _ := countField.ConcreteAt(0); count != int64(2) {
+		t.Errorf("expected %v, got %v", int64(2), count)
+	}
+}
+
+func TestWindowEventBatcherInitialFrame(t *testing.T) {
+	sender := &recordingSender{}
+	batcher := newWindowEventBatcher(sender, framefactory.FrameOptions{}, nil, false)
+	batcher.setSchema(espfield.NewSchema([]*espfield.SchemaField{idSchemaField}))
+	if frame := batcher.initialFrame(); frame != nil {
+		t.Errorf("expected nil, got %v", frame)
+	}
+
+	batcher.history = eventhistory.New(3, 0)
+	batcher.add(newTestEvents("insert", 1, 2))
+	batcher.add(newTestEvents("insert", 3, 4))
+
+	frame := batcher.initialFrame()
+	if frame == nil {
+		t.Fatalf("expected initial frame, got nil")
+	}
+	ids, _ := frame.FieldByName("id")
+	for i, expected := range []int64{2, 3, 4} {
+		if id, _ := ids.ConcreteAt(i); id != expected {
+			t.Errorf("expected %v, got %v", expected, id)
+		}
+	}
+
+	batcher.setSchema(espfield.NewSchema([]*espfield.SchemaField{idSchemaField, {Name: "value", Type: espfield.Double, TypeName: "double", Precision: -1}}))
+	if frame := batcher.initialFrame(); frame != nil {
+		t.Errorf("expected nil, got %v", frame)
+	}
+}
+
+func TestWindowEventBatcherInitialFrameOfState(t *testing.T) {
+	sender := &recordingSender{}
+	batcher := newWindowEventBatcher(sender, framefactory.FrameOptions{}, windowstate.New(10), false)
+	batcher.setSchema(espfield.NewSchema([]*espfield.SchemaField{idSchemaField}))
+	batcher.add(newTestEvents("insert", 1, 2))
+	batcher.add(newTestEvents("delete", 1))
+
+	frame := batcher.initialFrame()
+	if frame == nil {
+		t.Fatalf("expected initial frame, got nil")
+	}
+	if rowCount, _ := frame.RowLen(); rowCount != 1 {
+		t.Errorf("expected %v rows, got %v", 1, rowCount)
+	}
+}
+
+func TestWindowEventBatcherFiltersEvents(t *testing.T) {
+	sender := &recordingSender{}
+	batcher := newWindowEventBatcher(sender, framefactory.FrameOptions{}, nil, false)
+	batcher.setSchema(espfield.NewSchema([]*espfield.SchemaField{idSchemaField}))
+	eventFilter, err := filter.Parse("id >= 2")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	batcher.filter = eventFilter
+
+	batcher.add(newTestEvents("insert", 1, 2, 3))
+	batcher.add(newTestEvents("insert", 1))
+	assertRowCounts(t, sender, 2)
+}
+
+func TestWindowEventBatcherFiltersWindowState(t *testing.T) {
+	severitySchemaField := &espfield.SchemaField{Name: "severity", Type: espfield.String, TypeName: "string", Precision: -1}
+	newEvent := func(opcode string, id int64, severity string) windowevent.WindowEvent {
+		return windowevent.New(time.UnixMicro(id), opcode, []espfield.Field{
+			espfield.FromSchema(idSchemaField, id),
+			espfield.FromSchema(severitySchemaField, severity),
+		})
+	}
+
+	sender := &recordingSender{}
+	batcher := newWindowEventBatcher(sender, framefactory.FrameOptions{}, windowstate.New(0), false)
+	batcher.setSchema(espfield.NewSchema([]*espfield.SchemaField{idSchemaField, severitySchemaField}))
+	eventFilter, err := filter.Parse("severity = 'HIGH'")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	batcher.filter = eventFilter
+
+	batcher.add([]windowevent.WindowEvent{newEvent("insert", 1, "HIGH"), newEvent("insert", 2, "HIGH"), newEvent("insert", 3, "LOW")})
+	batcher.add([]windowevent.WindowEvent{newEvent("update", 1, "LOW")})
+	batcher.add([]windowevent.WindowEvent{newEvent("update", 3, "HIGH")})
+	assertRowCounts(t, sender, 2, 1, 2)
+
+	frame := batcher.initialFrame()
+	if frame == nil {
+		t.Fatalf("expected initial frame, got nil")
+	}
+	ids, _ := frame.FieldByName("id")
+	for i, expected := range []int64{2, 3} {
+		if id, _ := ids.ConcreteAt(i); id != expected {
+			t.Errorf("expected %v, got %v", expected, id)
+		}
+	}
+}
@@ -6,7 +6,7 @@
 import React, {useMemo, useState} from 'react';
 import {Checkbox, Field, InlineLabel, Input, Select, Stack} from '@grafana/ui';
 import {DataSourcePluginOptionsEditorProps, SelectableValue} from '@grafana/data';
-import {EspDataSourceOptions} from '../types';
+import {DecodeErrorPolicy, EspDataSourceOptions, SubscriptionFormat} from '../types';
 
 interface DiscoveryOption {
     label: string,
@@ -23,6 +23,19 @@ ConfigEditor.DISCOVERY_DEFAULT_OPTIONS_TLS = [
     {label: 'SAS Event Stream Processing Studio', value: 'https://sas-event-stream-processing-studio-app/SASEventStreamProcessingStudio'},
 ];
 
+const SUBSCRIPTION_FORMAT_OPTIONS: Array<SelectableValue<SubscriptionFormat>> = [
+    {label: "CBOR", value: "cbor"},
+    {label: "JSON", value: "json"},
+];
+ConfigEditor.SUBSCRIPTION_FORMAT_OPTIONS = SUBSCRIPTION_FORMAT_OPTIONS;
+
+const DECODE_ERROR_POLICY_OPTIONS: Array<SelectableValue<DecodeErrorPolicy>> = [
+    {label: "Set invalid fields to null", value: "null-field"},
+    {label: "Leave out invalid fields", value: "skip-field"},
+    {label: "Drop events with invalid fields", value: "skip-event"},
+];
+ConfigEditor.DECODE_ERROR_POLICY_OPTIONS = DECODE_ERROR_POLICY_OPTIONS;
+
 enum HOST_TYPE_OPTION_VALUES {DISCOVERY_DEFAULT, DISCOVERY_URL, ESP_URL}
 ConfigEditor.HOST_TYPE_OPTIONS = [
     {label: "Internal Discovery Service", value: HOST_TYPE_OPTION_VALUES.DISCOVERY_DEFAULT},
@@ -105,6 +118,29 @@ export function ConfigEditor({options, onOptionsChange}: Readonly<DataSourcePlug
         changePropOptionsJsonData({directToEsp: selectable?.value === HOST_TYPE_OPTION_VALUES.ESP_URL});
     }
 
+    const handleSubscriptionFormatChange = (selectable: SelectableValue<SubscriptionFormat>) => {
+        changePropOptionsJsonData({subscriptionFormat: selectable?.value ?? "cbor"});
+    }
+
+    const handleDecodeErrorPolicyChange = (selectable: SelectableValue<DecodeErrorPolicy>) => {
+        changePropOptionsJsonData({decodeErrorPolicy: selectable?.value ?? "null-field"});
+    }
+
+    const handleFrameIntervalChange = (value: string) => {
+        const frameIntervalMs = parseInt(value, 10);
+        changePropOptionsJsonData({frameIntervalMs: frameIntervalMs > 0 ? frameIntervalMs : undefined});
+    }
+
+    const handleHistoryMaxEventsChange = (value: string) => {
+        const historyMaxEvents = parseInt(value, 10);
+        changePropOptionsJsonData({historyMaxEvents: historyMaxEvents > 0 ? historyMaxEvents : undefined});
+    }
+
+    const handleHistoryMaxAgeChange = (value: string) => {
+        const historyMaxAgeMs = parseInt(value, 10);
+        changePropOptionsJsonData({historyMaxAgeMs: historyMaxAgeMs > 0 ? historyMaxAgeMs : undefined});
+    }
+
     const handleOauthPassthroughCheckboxChange = (checked: boolean) => {
         changePropOptionsJsonData({oauthPassThru: checked});
     }
@@ -144,6 +180,19 @@ export function ConfigEditor({options, onOptionsChange}: Readonly<DataSourcePlug
                                        oauth={jsonData.oauthPassThru} onOauthChange={handleOauthPassthroughCheckboxChange}
                                        tls={isDiscoveryServiceTlsEnabled} onTlsChange={handleTlsCheckboxChange}/>
                 </Stack>
+                <InlineLabel width="auto">Subscription format</InlineLabel>
+                <Select options={ConfigEditor.SUBSCRIPTION_FORMAT_OPTIONS} value={jsonData.subscriptionFormat ?? "cbor"} onChange={handleSubscriptionFormatChange}/>
+                <InlineLabel width="auto">Invalid event fields</InlineLabel>
+                <Select options={ConfigEditor.DECODE_ERROR_POLICY_OPTIONS} value={jsonData.decodeErrorPolicy ?? "null-field"} onChange={handleDecodeErrorPolicyChange}/>
+                <InlineLabel width="auto">Frame interval (ms)</InlineLabel>
+                <Input type="number" min={0} placeholder="0 (send events as received)" value={jsonData.frameIntervalMs ?? ""}
+                       onChange={e => handleFrameIntervalChange(e.currentTarget.value)}/>
+                <InlineLabel width="auto">History size (events)</InlineLabel>
+                <Input type="number" min={0} max={100000} placeholder="0 (no history)" value={jsonData.historyMaxEvents ?? ""}
+                       onChange={e => handleHistoryMaxEventsChange(e.currentTarget.value)}/>
+                <InlineLabel width="auto">History age (ms)</InlineLabel>
+                <Input type="number" min={0} placeholder="0 (no age limit)" value={jsonData.historyMaxAgeMs ?? ""}
+                       onChange={e => handleHistoryMaxAgeChange(e.currentTarget.value)}/>
             </div>
         </Stack>
     );
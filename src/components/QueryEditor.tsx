@@ -4,10 +4,12 @@
 */
 
 import React, {PureComponent} from 'react';
-import {Alert, Select, SelectCommonProps} from '@grafana/ui';
+import {Alert, InlineSwitch, Input, Select, SelectCommonProps} from '@grafana/ui';
 import {QueryEditorProps, SelectableValue} from '@grafana/data';
 import {DataSource} from '../datasource';
 import {
+  AggregateFunction,
+  ArrayLayout,
   ContinuousQuery,
   EspDataSourceOptions,
   EspObject,
@@ -17,6 +19,7 @@ import {
   getEspObjectType,
   Project,
   Server,
+  SubscriptionFormat,
   Window,
 } from '../types';
 
@@ -47,6 +50,15 @@ interface State {
   selectedCq: ContinuousQuery | null | undefined;
   selectedWindow: Window | null | undefined;
   selectedFields: Field[];
+  selectedFormat: SubscriptionFormat | undefined;
+  isMaterialized: boolean;
+  selectedTimeField: string | undefined;
+  isEventTimestampOmitted: boolean;
+  selectedSeriesFields: string[];
+  selectedArrayLayout: ArrayLayout | undefined;
+  aggregationIntervalMs: number | undefined;
+  filter: string | undefined;
+  selectedAggregationFunctions: AggregateFunction[];
   errorMessage: String | null | undefined;
 }
 
@@ -69,6 +81,15 @@ export class QueryEditor extends PureComponent<Props> {
       selectedCq: undefined,
       selectedWindow: undefined,
       selectedFields: [],
+      selectedFormat: props.query.format,
+      isMaterialized: props.query.materialized ?? false,
+      selectedTimeField: props.query.timeField,
+      isEventTimestampOmitted: props.query.omitEventTimestamp ?? false,
+      selectedSeriesFields: props.query.seriesFields ?? [],
+      selectedArrayLayout: props.query.arrayLayout,
+      aggregationIntervalMs: props.query.aggregationIntervalMs,
+      filter: props.query.filter,
+      selectedAggregationFunctions: props.query.aggregationFunctions ?? [],
       errorMessage: undefined
     };
 
@@ -163,10 +184,200 @@ export class QueryEditor extends PureComponent<Props> {
             placeholder={'Fields'}
             noOptionsMessage={'No options found'}
         />
+        <Select
+            key={'format'}
+            isMulti={false}
+            isClearable={true}
+            options={QueryEditor.FORMAT_OPTIONS}
+            onChange={this.onFormatSelect}
+            value={state.selectedFormat ?? null}
+            placeholder={'Format (data source default)'}
+        />
+        <InlineSwitch
+            id={'materialized'}
+            label={'Show current window contents'}
+            showLabel={true}
+            value={state.isMaterialized}
+            onChange={this.onMaterializedChange}
+        />
+        <Select
+            key={'timeField'}
+            isMulti={false}
+            isClearable={true}
+            options={state.fieldOptions
+                .filter((option) => QueryEditor.TIME_FIELD_TYPES.includes(option.value.type?.toLowerCase()))
+                .map((option) => ({ label: option.label, value: option.value.name }))}
+            onChange={this.onTimeFieldSelect}
+            value={state.selectedTimeField ?? null}
+            placeholder={'Time field (ESP event timestamp)'}
+        />
+        <InlineSwitch
+            id={'omitEventTimestamp'}
+            label={'Hide ESP event timestamp'}
+            showLabel={true}
+            value={state.isEventTimestampOmitted}
+            onChange={this.onOmitEventTimestampChange}
+        />
+        <Select
+            key={'seriesFields'}
+            isMulti={true}
+            isClearable={true}
+            backspaceRemovesValue={true}
+            options={state.fieldOptions.map((option) => ({ label: option.label, value: option.value.name }))}
+            onChange={this.onSeriesFieldsSelect}
+            value={state.selectedSeriesFields}
+            isSearchable={true}
+            maxMenuHeight={500}
+            placeholder={'Series fields'}
+            noOptionsMessage={'No options found'}
+        />
+        <Select
+            key={'arrayLayout'}
+            isMulti={false}
+            isClearable={true}
+            options={QueryEditor.ARRAY_LAYOUT_OPTIONS}
+            onChange={this.onArrayLayoutSelect}
+            value={state.selectedArrayLayout ?? null}
+            placeholder={'Arrays (JSON)'}
+        />
+        <Input
+            key={'aggregationInterval'}
+            type={'number'}
+            min={0}
+            defaultValue={state.aggregationIntervalMs ?? ''}
+            onBlur={this.onAggregationIntervalChange}
+            placeholder={'Aggregation interval in ms (no aggregation)'}
+        />
+        <Select
+            key={'aggregationFunctions'}
+            isMulti={true}
+            isClearable={true}
+            options={QueryEditor.AGGREGATE_FUNCTION_OPTIONS}
+            onChange={this.onAggregationFunctionsSelect}
+            value={state.selectedAggregationFunctions}
+            disabled={!state.aggregationIntervalMs}
+            placeholder={'Aggregate functions (avg)'}
+        />
+        <Input
+            key={'filter'}
+            defaultValue={state.filter ?? ''}
+            onBlur={this.onFilterChange}
+            placeholder={"Filter, such as severity = 'HIGH' (all events)"}
+        />
       </div>
     );
   }
 
+  static TIME_FIELD_TYPES: Array<string | undefined> = ['stamp', 'date'];
+
+  static FORMAT_OPTIONS: Array<SelectableValue<SubscriptionFormat>> = [
+    { label: 'CBOR', value: 'cbor' },
+    { label: 'JSON', value: 'json' },
+  ];
+
+  static ARRAY_LAYOUT_OPTIONS: Array<SelectableValue<ArrayLayout>> = [
+    { label: 'Columns per index', value: 'columns' },
+    { label: 'Rows per element', value: 'rows' },
+  ];
+
+  static AGGREGATE_FUNCTION_OPTIONS: Array<SelectableValue<AggregateFunction>> = [
+    { label: 'Minimum', value: 'min' },
+    { label: 'Maximum', value: 'max' },
+    { label: 'Average', value: 'avg' },
+    { label: 'Last', value: 'last' },
+    { label: 'Count', value: 'count' },
+  ];
+
+  onFormatSelect = async (selectableValue: SelectableValue<SubscriptionFormat> | null) => {
+    const format = selectableValue?.value;
+    this.espQueryController.setFormat(format);
+    await this.setStateWithPromise({ selectedFormat: format });
+
+    this.espQueryController.save();
+    this.espQueryController.execute();
+  };
+
+  onMaterializedChange = async (event: React.FormEvent<HTMLInputElement>) => {
+    const materialized = event.currentTarget.checked;
+    this.espQueryController.setMaterialized(materialized);
+    await this.setStateWithPromise({ isMaterialized: materialized });
+
+    this.espQueryController.save();
+    this.espQueryController.execute();
+  };
+
+  onTimeFieldSelect = async (selectableValue: SelectableValue<string> | null) => {
+    const timeField = selectableValue?.value;
+    this.espQueryController.setTimeField(timeField);
+    await this.setStateWithPromise({ selectedTimeField: timeField });
+
+    this.espQueryController.save();
+    this.espQueryController.execute();
+  };
+
+  onOmitEventTimestampChange = async (event: React.FormEvent<HTMLInputElement>) => {
+    const omitEventTimestamp = event.currentTarget.checked;
+    this.espQueryController.setOmitEventTimestamp(omitEventTimestamp);
+    await this.setStateWithPromise({ isEventTimestampOmitted: omitEventTimestamp });
+
+    this.espQueryController.save();
+    this.espQueryController.execute();
+  };
+
+  onArrayLayoutSelect = async (selectableValue: SelectableValue<ArrayLayout> | null) => {
+    const arrayLayout = selectableValue?.value;
+    this.espQueryController.setArrayLayout(arrayLayout);
+    await this.setStateWithPromise({ selectedArrayLayout: arrayLayout });
+
+    this.espQueryController.save();
+    this.espQueryController.execute();
+  };
+
+  onAggregationIntervalChange = async (event: React.FocusEvent<HTMLInputElement>) => {
+    const aggregationIntervalMs = parseInt(event.currentTarget.value, 10);
+    const interval = aggregationIntervalMs > 0 ? aggregationIntervalMs : undefined;
+    if (interval === this.state.aggregationIntervalMs) {
+      return;
+    }
+
+    this.espQueryController.setAggregationInterval(interval);
+    await this.setStateWithPromise({ aggregationIntervalMs: interval });
+
+    this.espQueryController.save();
+    this.espQueryController.execute();
+  };
+
+  onFilterChange = async (event: React.FocusEvent<HTMLInputElement>) => {
+    const filter = event.currentTarget.value.trim() || undefined;
+    if (filter === this.state.filter) {
+      return;
+    }
+
+    this.espQueryController.setFilter(filter);
+    await this.setStateWithPromise({ filter: filter });
+
+    this.espQueryController.save();
+    this.espQueryController.execute();
+  };
+
+  onAggregationFunctionsSelect = async (selectableValues: Array<SelectableValue<AggregateFunction>> | null) => {
+    const aggregationFunctions = (selectableValues ?? []).map((selectableValue) => selectableValue.value!);
+    this.espQueryController.setAggregationFunctions(aggregationFunctions);
+    await this.setStateWithPromise({ selectedAggregationFunctions: aggregationFunctions });
+
+    this.espQueryController.save();
+    this.espQueryController.execute();
+  };
+
+  onSeriesFieldsSelect = async (selectableValues: Array<SelectableValue<string>> | null) => {
+    const seriesFields = (selectableValues ?? []).map((selectableValue) => selectableValue.value!);
+    this.espQueryController.setSeriesFields(seriesFields);
+    await this.setStateWithPromise({ selectedSeriesFields: seriesFields });
+
+    this.espQueryController.save();
+    this.espQueryController.execute();
+  };
+
   onSelect = async (selectableValue: SelectableValue<EspObject>) => {
     if (!selectableValue.value) {
       throw Error('Expected selection event to provide a selectable value.');
@@ -457,4 +668,40 @@ class EspQueryController {
   setFields(fields: Field[]): void {
     this.espQuery.fields = fields.map(field => field.name);
   }
+
+  setFormat(format: SubscriptionFormat | undefined): void {
+    this.espQuery.format = format;
+  }
+
+  setMaterialized(materialized: boolean): void {
+    this.espQuery.materialized = materialized || undefined;
+  }
+
+  setTimeField(timeField: string | undefined): void {
+    this.espQuery.timeField = timeField;
+  }
+
+  setOmitEventTimestamp(omitEventTimestamp: boolean): void {
+    this.espQuery.omitEventTimestamp = omitEventTimestamp || undefined;
+  }
+
+  setSeriesFields(seriesFields: string[]): void {
+    this.espQuery.seriesFields = seriesFields.length > 0 ? seriesFields : undefined;
+  }
+
+  setArrayLayout(arrayLayout: ArrayLayout | undefined): void {
+    this.espQuery.arrayLayout = arrayLayout;
+  }
+
+  setFilter(filter: string | undefined): void {
+    this.espQuery.filter = filter;
+  }
+
+  setAggregationInterval(aggregationIntervalMs: number | undefined): void {
+    this.espQuery.aggregationIntervalMs = aggregationIntervalMs;
+  }
+
+  setAggregationFunctions(aggregationFunctions: AggregateFunction[]): void {
+    this.espQuery.aggregationFunctions = aggregationFunctions.length > 0 ? aggregationFunctions : undefined;
+  }
 }
@@ -3,8 +3,13 @@
 	SPDX-License-Identifier: Apache-2.0
 */
 
-import {DataQueryError, DataQueryRequest, DataQueryResponse, DataSourceInstanceSettings} from '@grafana/data';
-import { DataSourceWithBackend } from '@grafana/runtime';
+import {DataFrame, DataQueryError, DataQueryRequest, DataQueryResponse, DataSourceInstanceSettings} from '@grafana/data';
+import {
+  DataSourceWithBackend,
+  standardStreamOptionsProvider,
+  StreamingFrameAction,
+  StreamingFrameOptions,
+} from '@grafana/runtime';
 import { EspDataSourceOptions, EspQuery } from './types';
 import { Observable } from 'rxjs';
 import { map } from 'rxjs/operators';
@@ -12,6 +17,19 @@ import { map } from 'rxjs/operators';
 export class DataSource extends DataSourceWithBackend<EspQuery, EspDataSourceOptions> {
   constructor(instanceSettings: DataSourceInstanceSettings<EspDataSourceOptions>) {
     super(instanceSettings);
+    this.streamOptionsProvider = DataSource.getStreamOptions;
+  }
+
+  private static getStreamOptions(request: DataQueryRequest<EspQuery>, frame: DataFrame): Partial<StreamingFrameOptions> {
+    const options = standardStreamOptionsProvider(request, frame);
+
+    // Materialized queries receive the current window contents in every frame, which replace the previous ones.
+    const query = request.targets.find((target) => target.refId === frame.refId);
+    if (query?.materialized) {
+      options.action = StreamingFrameAction.Replace;
+    }
+
+    return options;
   }
 
   query(options: DataQueryRequest<EspQuery>): Observable<DataQueryResponse> {
@@ -35,6 +53,13 @@ export class DataSource extends DataSourceWithBackend<EspQuery, EspDataSourceOpt
             return event;
         }
 
+        const lastPluginStatus = DataSource.getLastPluginStatus(event);
+        if (lastPluginStatus) {
+            // Status frames report transient conditions such as reconnection attempts, so previous data is kept.
+            DataSource.addErrorToEvent(event, lastPluginStatus);
+            return event;
+        }
+
         const opcodeField = lastFrame.fields.find((field: any) => field.name === '@opcode');
         if (opcodeField) {
           const opcodeValues = DataSource.getFieldValues(opcodeField);
@@ -85,6 +110,21 @@ export class DataSource extends DataSourceWithBackend<EspQuery, EspDataSourceOpt
         return {message: lastValue};
     }
 
+    private static getLastPluginStatus(event: any): DataQueryError | undefined {
+        const lastFrame = event.data.at(-1);
+        const statusField = lastFrame.fields.find((field: any) => field.name === '@status');
+        if (!statusField || !statusField.values.length) {
+            return;
+        }
+
+        const lastValue = DataSource.getLastPluginErrorFieldValue(statusField);
+        if (lastValue == null) {
+            return;
+        }
+
+        return {message: lastValue};
+    }
+
     private static getLastPluginErrorFieldValue(pluginErrorField: any): any | undefined {
         const isLegacyField = !(pluginErrorField.values instanceof Array);
         if (isLegacyField) {
@@ -12,8 +12,23 @@ export interface EspQuery extends DataQuery {
   cqName: string | null;
   windowName: string | null;
   fields: string[];
+  format?: SubscriptionFormat;
+  materialized?: boolean;
+  timeField?: string;
+  omitEventTimestamp?: boolean;
+  seriesFields?: string[];
+  arrayLayout?: ArrayLayout;
+  aggregationIntervalMs?: number;
+  filter?: string;
+  aggregationFunctions?: AggregateFunction[];
 }
 
+export type SubscriptionFormat = 'cbor' | 'json';
+
+export type ArrayLayout = 'columns' | 'rows';
+
+export type AggregateFunction = 'min' | 'max' | 'avg' | 'last' | 'count';
+
 export interface  Field {
   name: string;
   type: string;
@@ -100,4 +115,11 @@ export interface EspDataSourceOptions extends DataSourceJsonData {
   tlsSkipVerify: boolean;
   useExternalEspUrl: boolean;
   directToEsp: boolean;
+  subscriptionFormat?: SubscriptionFormat;
+  decodeErrorPolicy?: DecodeErrorPolicy;
+  frameIntervalMs?: number;
+  historyMaxEvents?: number;
+  historyMaxAgeMs?: number;
 }
+
+export type DecodeErrorPolicy = 'null-field' | 'skip-field' | 'skip-event';